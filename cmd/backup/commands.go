@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/app"
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/control"
+	"github.com/xg4/vaultwarden-backup/internal/notify"
+	"github.com/xg4/vaultwarden-backup/pkg/sign"
+)
+
+// runCommand 执行子命令并返回退出码
+func runCommand(args []string) int {
+	switch args[0] {
+	case "dry-run":
+		return dryRun(args[1:])
+	case "config":
+		if len(args) < 2 || args[1] != "check" {
+			fmt.Fprintf(os.Stderr, "用法: vaultb config check\n")
+			return 2
+		}
+		return configCheck()
+	case "reload":
+		return reloadCommand()
+	case "healthcheck":
+		return healthcheck(args[1:])
+	case "history":
+		return history(args[1:])
+	case "show":
+		return show(args[1:])
+	case "keygen":
+		return keygen(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "未知的子命令: %s\n\n", args[0])
+		fmt.Fprintf(os.Stderr, "用法: vaultb [dry-run [任务] | config check | reload | healthcheck [live] | history [任务] | show <ID> | keygen <私钥路径>]\n")
+		fmt.Fprintf(os.Stderr, "  (无参数)      启动备份服务\n")
+		fmt.Fprintf(os.Stderr, "  dry-run       打印将要备份的文件列表，不执行备份；可指定任务名称\n")
+		fmt.Fprintf(os.Stderr, "  config check  校验配置并打印生效的配置（敏感值已脱敏）\n")
+		fmt.Fprintf(os.Stderr, "  reload        通过控制 socket 让运行中的服务重新加载配置\n")
+		fmt.Fprintf(os.Stderr, "  healthcheck   查询运行中服务的就绪状态；指定 live 时只检查存活\n")
+		fmt.Fprintf(os.Stderr, "  history       列出备份目录文件中的运行记录；可指定任务名称\n")
+		fmt.Fprintf(os.Stderr, "  show          打印一次运行的详细记录，ID 可只输入前几位\n")
+		fmt.Fprintf(os.Stderr, "  keygen        生成签名归档用的 Ed25519 密钥对，公钥写入 <私钥路径>.pub\n")
+		return 2
+	}
+}
+
+// keygen 生成签名密钥对，已存在的文件不会被覆盖
+func keygen(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "用法: vaultb keygen <私钥路径>\n")
+		return 2
+	}
+
+	pub, err := sign.GenerateKey(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "生成密钥失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("私钥: %s（设置为 SIGNING_KEY_FILE，请妥善保管）\n", args[0])
+	fmt.Printf("公钥: %s（恢复时通过 vaultr -public-key 指定）\n", args[0]+sign.PublicExt)
+	fmt.Printf("密钥 ID: %s\n", sign.KeyID(pub))
+	return 0
+}
+
+// catalogHealthcheck 根据备份目录文件判断每个任务最近一次成功备份是否在 HEALTH_MAX_AGE 以内。
+// 无法从外部确认服务进程是否响应，live 只检查配置能否加载
+func catalogHealthcheck(settings *config.Settings, live bool) int {
+	if live {
+		fmt.Println("ok")
+		return 0
+	}
+
+	var problems []string
+	for _, cfg := range settings.Jobs {
+		records, err := catalog.Load(cfg.BackupDir)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: 读取备份目录文件失败: %v", cfg.Name, err))
+			continue
+		}
+
+		var last *catalog.Record
+		for i := range records {
+			if rec := &records[i]; rec.Job == cfg.Name && rec.Status == catalog.StatusSuccess && (last == nil || rec.End.After(last.End)) {
+				last = rec
+			}
+		}
+		switch {
+		case last == nil:
+			problems = append(problems, fmt.Sprintf("%s: 尚无成功的备份", cfg.Name))
+		case time.Since(last.End) > cfg.HealthMaxAge:
+			problems = append(problems, fmt.Sprintf("%s: 最近一次成功备份于 %s，超过 %s", cfg.Name, last.End.Format(time.RFC3339), cfg.HealthMaxAge))
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "健康检查失败:\n%s\n", strings.Join(problems, "\n"))
+		return 1
+	}
+	fmt.Println("ok")
+	return 0
+}
+
+// dryRun 打印备份计划，指定任务名称时只打印该任务
+func dryRun(args []string) int {
+	settings, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "配置加载失败: %v\n", err)
+		return 1
+	}
+
+	jobs := settings.Jobs
+	if len(args) > 0 {
+		jobs = nil
+		for _, cfg := range settings.Jobs {
+			if cfg.Name == args[0] {
+				jobs = append(jobs, cfg)
+			}
+		}
+		if len(jobs) == 0 {
+			fmt.Fprintf(os.Stderr, "未找到任务: %s\n", args[0])
+			return 1
+		}
+	}
+
+	for i, cfg := range jobs {
+		if len(settings.Jobs) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("== 任务 %s ==\n", cfg.Name)
+		}
+		if err := app.New(cfg).DryRun(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "生成备份计划失败: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// configCheck 校验配置文件和环境变量，打印合并后的配置
+func configCheck() int {
+	settings, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "配置加载失败: %v\n", err)
+		return 1
+	}
+
+	if _, err := notify.NewTargets(settings.Notify); err != nil {
+		fmt.Fprintf(os.Stderr, "通知配置无效: %v\n", err)
+		return 1
+	}
+
+	out, err := settings.Redacted()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "输出配置失败: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
+
+// reloadCommand 通过控制 socket 通知运行中的服务重新加载配置
+func reloadCommand() int {
+	path := os.Getenv("CONTROL_SOCKET")
+	if path == "" {
+		if settings, err := config.Load(); err == nil {
+			path = settings.ControlSocket
+		}
+	}
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "未设置 CONTROL_SOCKET\n")
+		return 1
+	}
+
+	msg, err := control.Send(path, "reload")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "重新加载失败: %v\n", err)
+		return 1
+	}
+	fmt.Println(msg)
+	return 0
+}
+
+// healthcheck 查询运行中服务的 /readyz（或 /healthz），供 Docker HEALTHCHECK 使用；
+// 未启用 HTTP 接口时改为读取备份目录中的运行记录
+func healthcheck(args []string) int {
+	live := len(args) > 0 && args[0] == "live"
+	path := "/readyz"
+	if live {
+		path = "/healthz"
+	}
+
+	addr := os.Getenv("LISTEN_ADDR")
+	if addr == "" {
+		settings, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "配置加载失败: %v\n", err)
+			return 1
+		}
+		addr = settings.ListenAddr
+		if addr == "" {
+			return catalogHealthcheck(settings, live)
+		}
+	}
+
+	// 监听所有地址时通过本机回环地址访问
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无效的 LISTEN_ADDR: %v\n", err)
+		return 1
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "健康检查失败: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "健康检查失败 (%s):\n%s", resp.Status, body)
+		return 1
+	}
+	fmt.Print(string(body))
+	return 0
+}
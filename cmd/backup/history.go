@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+)
+
+// entry 带有所在备份目录的目录记录
+type entry struct {
+	dir     string
+	corrupt *catalog.Check // 最近一次巡检发现归档已损坏
+	catalog.Record
+}
+
+// loadCatalogs 读取所有任务备份目录中的目录文件；配置无法加载（如未设置密码）时读取 BACKUP_DIR
+func loadCatalogs() ([]entry, error) {
+	dirs := map[string]bool{}
+	if settings, err := config.Load(); err == nil {
+		for _, cfg := range settings.Jobs {
+			dirs[cfg.BackupDir] = true
+		}
+	} else {
+		dirs[getEnv("BACKUP_DIR", "/backups")] = true
+	}
+
+	var entries []entry
+	for dir := range dirs {
+		records, err := catalog.Load(dir)
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", filepath.Join(dir, catalog.FileName), err)
+		}
+		checks, err := catalog.LoadChecks(dir)
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", filepath.Join(dir, catalog.ScrubFileName), err)
+		}
+		corrupted := catalog.Corrupted(checks)
+		for _, rec := range records {
+			e := entry{dir: dir, Record: rec}
+			if c, ok := corrupted[rec.Archive]; ok && rec.Archive != "" {
+				e.corrupt = &c
+			}
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Start.Before(entries[j].Start) })
+	return entries, nil
+}
+
+// history 列出备份运行记录，可指定任务名称
+func history(args []string) int {
+	entries, err := loadCatalogs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t时间\t任务\t状态\t耗时\t大小\t归档")
+	count := 0
+	for _, e := range entries {
+		if len(args) > 0 && e.Job != args[0] {
+			continue
+		}
+		status := "✅"
+		if e.Status != catalog.StatusSuccess {
+			status = "❌"
+		}
+		size, archive := "-", "-"
+		if e.Archive != "" {
+			size, archive = utils.FormatBytes(e.Size), e.Archive+archiveState(e)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", shortID(e.ID), e.Start.Local().Format("2006-01-02 15:04:05"),
+			e.Job, status, e.Duration().Round(time.Second), size, archive)
+		count++
+	}
+	w.Flush()
+
+	if count == 0 {
+		fmt.Fprintln(os.Stderr, "没有备份记录")
+	}
+	return 0
+}
+
+// show 打印一次运行的详细记录
+func show(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "用法: vaultb show <ID>\n")
+		return 2
+	}
+
+	entries, err := loadCatalogs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	records := make([]catalog.Record, len(entries))
+	for i, e := range entries {
+		records[i] = e.Record
+	}
+	rec, err := catalog.Find(records, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	var e entry
+	for _, e = range entries {
+		if e.ID == rec.ID {
+			break
+		}
+	}
+
+	fmt.Printf("ID:       %s\n", e.ID)
+	fmt.Printf("任务:     %s (%s)\n", e.Job, e.BackupName)
+	fmt.Printf("状态:     %s\n", e.Status)
+	fmt.Printf("开始:     %s\n", e.Start.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("耗时:     %s\n", e.Duration().Round(time.Millisecond))
+	if e.Archive != "" {
+		fmt.Printf("归档:     %s%s\n", filepath.Join(e.dir, e.Archive), archiveState(e))
+		fmt.Printf("大小:     %s\n", utils.FormatBytes(e.Size))
+		fmt.Printf("SHA-256:  %s\n", e.SHA256)
+		fmt.Printf("内容:     %d 个文件，%s\n", e.Files, utils.FormatBytes(e.Bytes))
+	}
+	if e.corrupt != nil {
+		fmt.Printf("巡检:     ❌ %s（%s）\n", e.corrupt.Problem, e.corrupt.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	if e.DBEngine != "" {
+		fmt.Printf("数据库:   %s %s\n", e.DBEngine, e.DBVersion)
+	}
+	if e.Error != "" {
+		fmt.Printf("错误:     %s\n", e.Error)
+	}
+	if len(e.Tasks) > 0 {
+		fmt.Println("\n任务:")
+		for _, t := range e.Tasks {
+			result := "✅"
+			if t.Error != "" {
+				result = "❌ " + t.Error
+			}
+			fmt.Printf("  - %s: %s %s\n", t.Name, t.Duration.Round(time.Millisecond), result)
+		}
+	}
+	if len(e.Pruned) > 0 {
+		fmt.Println("\n清理的旧备份:")
+		for _, p := range e.Pruned {
+			fmt.Printf("  - %s\n", p)
+		}
+	}
+	if e.Archive != "" && archiveState(e) == "" {
+		fmt.Printf("\n恢复: vaultr -i %s -id %s -o ./restored\n", e.dir, shortID(e.ID))
+	}
+	return 0
+}
+
+// shortID 返回用于显示的 ID 前缀；手工编辑或旧版本写入的记录 ID 可能不足 8 位
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// archiveState 归档已不存在或巡检发现损坏时返回提示
+func archiveState(e entry) string {
+	if _, err := os.Stat(filepath.Join(e.dir, e.Archive)); err != nil {
+		return " (已删除)"
+	}
+	if e.corrupt != nil {
+		return " (已损坏)"
+	}
+	return ""
+}
+
+// getEnv 获取环境变量，如果不存在则返回默认值
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
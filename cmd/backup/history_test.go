@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestShortID(t *testing.T) {
+	tests := map[string]string{
+		"":                 "",
+		"abc":              "abc",
+		"0123abcd":         "0123abcd",
+		"0123abcd4567ef89": "0123abcd",
+	}
+	for id, want := range tests {
+		if got := shortID(id); got != want {
+			t.Errorf("shortID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/daemon"
+)
+
+// serveHTTP 在 addr 上启动 HTTP 服务，监听失败时立即返回错误
+func serveHTTP(addr string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听 %s 失败: %w", addr, err)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("🚨 HTTP 服务异常退出", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// handleHealthz 存活检查：进程运行且所有定时循环都能响应
+func (s *service) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	if err := s.daemon.Alive(5 * time.Second); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz 就绪检查：每个任务最近一次成功备份都在 HEALTH_MAX_AGE 以内
+func (s *service) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	var problems []string
+	for _, job := range s.daemon.Status() {
+		if job.Ready {
+			continue
+		}
+		switch {
+		case job.LastSuccess == nil && job.LastError != "":
+			problems = append(problems, fmt.Sprintf("%s: 尚无成功的备份，最近错误: %s", job.Name, job.LastError))
+		case job.LastSuccess == nil:
+			problems = append(problems, fmt.Sprintf("%s: 尚无成功的备份", job.Name))
+		default:
+			problems = append(problems, fmt.Sprintf("%s: 最近一次成功备份于 %s，超过 %s", job.Name, job.LastSuccess.Format(time.RFC3339), job.MaxAge))
+		}
+	}
+
+	if len(problems) > 0 {
+		http.Error(w, strings.Join(problems, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleStatus 以 JSON 返回各任务的状态
+func (s *service) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	jobs := s.daemon.Status()
+	ready := true
+	for _, job := range jobs {
+		ready = ready && job.Ready
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Ready bool               `json:"ready"`
+		Jobs  []daemon.JobStatus `json:"jobs"`
+	}{ready, jobs})
+}
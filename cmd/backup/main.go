@@ -2,124 +2,169 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"path/filepath"
 	"syscall"
 	"time"
 
-	"github.com/xg4/vaultwarden-backup/internal/app"
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/control"
+	"github.com/xg4/vaultwarden-backup/internal/daemon"
 	"github.com/xg4/vaultwarden-backup/internal/logger"
+	"github.com/xg4/vaultwarden-backup/internal/metrics"
+	"github.com/xg4/vaultwarden-backup/internal/notify"
 )
 
 func main() {
+	// 子命令不启动备份服务
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// 初始化日志记录器
 	logger.Setup()
 
 	// 加载配置
-	cfg, err := config.Load()
+	settings, err := config.Load()
 	if err != nil {
 		slog.Error("🚨 配置加载失败", "error", err)
 		os.Exit(1)
 	}
 
 	// 显示关键配置信息
-	slog.Info("🚀 启动备份服务", "ENV", cfg)
+	slog.Info("🚀 启动备份服务", "jobs", len(settings.Jobs), "max_concurrent_jobs", settings.MaxConcurrentJobs)
+	for _, cfg := range settings.Jobs {
+		slog.Info("📋 备份任务", "job", cfg.Name, "ENV", cfg)
+	}
 
 	// 设置优雅关闭
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 监听系统信号
+	// 监听系统信号，SIGHUP 重新加载配置
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	// 创建备份应用
-	backupApp := app.New(cfg)
+	// 启动所有备份任务
+	targets, err := notify.NewTargets(settings.Notify)
+	if err != nil {
+		slog.Error("🚨 通知配置无效", "error", err)
+		os.Exit(1)
+	}
 
-	// 执行初始备份
-	slog.Info("📦 执行初始备份")
-	if err := backupApp.Run(); err != nil {
-		slog.Error("🚨 初始备份失败", "error", err)
+	svc := &service{
+		started: settings,
+		daemon:  daemon.New(settings),
+		metrics: metrics.New(),
+		notify:  notify.NewDispatcher(targets, digestStateFile(settings)),
+	}
+	svc.daemon.OnRun(svc.metrics.Observe)
+	svc.daemon.OnRun(svc.notify.Observe)
+	svc.daemon.OnScrub(svc.metrics.ObserveScrub)
+	svc.daemon.OnScrub(svc.notify.ObserveScrub)
+	svc.daemon.Start(ctx)
+	svc.notify.Start(ctx)
+
+	// 启动 HTTP 服务
+	if settings.ListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", svc.metrics)
+		mux.HandleFunc("GET /healthz", svc.handleHealthz)
+		mux.HandleFunc("GET /readyz", svc.handleReadyz)
+		mux.HandleFunc("GET /status", svc.handleStatus)
+		server, err := serveHTTP(settings.ListenAddr, mux)
+		if err != nil {
+			slog.Error("🚨 HTTP 服务启动失败", "error", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+		slog.Info("🌐 HTTP 服务已启动", "addr", settings.ListenAddr)
 	}
 
-	// 启动定时备份
-	ticker := time.NewTicker(cfg.BackupInterval)
-	defer ticker.Stop()
-
-	slog.Info("⏰ 定时备份已启动", "interval", cfg.BackupInterval)
-
-	// 用于跟踪正在进行的备份
-	var backupInProgress bool
-	var backupMutex sync.Mutex
-
-	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("🛑 收到停止信号，正在关闭...")
-			return
-		case <-sigChan:
-			slog.Info("🔄 收到系统信号，正在优雅关闭...")
-
-			// 检查是否有备份正在进行
-			backupMutex.Lock()
-			if backupInProgress {
-				slog.Info("⏳ 等待当前备份任务完成...")
-				backupMutex.Unlock()
-
-				// 等待备份完成，最多等待10 秒
-				timeout := time.NewTimer(1 * time.Second)
-				defer timeout.Stop()
-
-				for {
-					time.Sleep(time.Second)
-					backupMutex.Lock()
-					if !backupInProgress {
-						backupMutex.Unlock()
-						break
-					}
-					backupMutex.Unlock()
-
-					select {
-					case <-timeout.C:
-						slog.Warn("⚠️ 等待备份完成超时，强制退出")
-						cancel()
-						return
-					default:
-					}
-				}
-			} else {
-				backupMutex.Unlock()
+	// 启动控制 socket
+	if settings.ControlSocket != "" {
+		server, err := control.Listen(settings.ControlSocket, func(cmd string) (string, error) {
+			switch cmd {
+			case "reload":
+				return svc.reload()
+			default:
+				return "", fmt.Errorf("未知的命令: %s", cmd)
 			}
+		})
+		if err != nil {
+			slog.Error("🚨 控制 socket 启动失败", "error", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+		slog.Info("🎛️ 控制 socket 已启动", "path", settings.ControlSocket)
+	}
 
-			slog.Info("✅ 备份任务已完成，安全退出")
-			cancel()
-			return
-		case <-ticker.C:
-			// 检查是否已经有备份在进行
-			backupMutex.Lock()
-			if backupInProgress {
-				slog.Debug("⏭️ 跳过定时备份，上一个备份仍在进行中")
-				backupMutex.Unlock()
-				continue
-			}
-			backupInProgress = true
-			backupMutex.Unlock()
-
-			slog.Debug("🔄 开始定时备份")
-			go func() {
-				defer func() {
-					backupMutex.Lock()
-					backupInProgress = false
-					backupMutex.Unlock()
-				}()
-
-				if err := backupApp.Run(); err != nil {
-					slog.Error("🚨 定时备份失败", "error", err)
-				}
-			}()
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			slog.Info("🔄 收到 SIGHUP，重新加载配置")
+			svc.reload()
+			continue
+		}
+		break
+	}
+
+	slog.Info("🔄 收到系统信号，正在优雅关闭...")
+	cancel()
+
+	// 等待正在进行的备份完成，最多等待 10 秒
+	slog.Info("⏳ 等待当前备份任务完成...")
+	if !svc.daemon.Wait(10 * time.Second) {
+		slog.Warn("⚠️ 等待备份完成超时，强制退出")
+		return
+	}
+
+	slog.Info("✅ 备份任务已完成，安全退出")
+}
+
+// service 备份服务运行时的各组件
+type service struct {
+	started *config.Settings // 启动时的配置，用于识别重新加载无法生效的修改
+	daemon  *daemon.Daemon
+	metrics *metrics.Registry
+	notify  *notify.Dispatcher
+}
+
+// reload 重新加载并校验配置，成功后替换正在运行的调度；失败时保留原配置
+func (s *service) reload() (string, error) {
+	settings, err := config.Load()
+	if err == nil {
+		var targets []*notify.Target
+		if targets, err = notify.NewTargets(settings.Notify); err == nil {
+			s.notify.SetTargets(targets, digestStateFile(settings), settings.Jobs)
 		}
 	}
+	if err != nil {
+		slog.Error("🚨 重新加载配置失败，继续使用原配置", "error", err)
+		return "", err
+	}
+
+	// HTTP 服务和控制 socket 只在启动时创建；日志设置只从环境变量读取，运行中无法改变
+	if settings.ListenAddr != s.started.ListenAddr {
+		slog.Warn("⚠️ LISTEN_ADDR 的修改需要重启服务才能生效", "current", s.started.ListenAddr, "configured", settings.ListenAddr)
+	}
+	if settings.ControlSocket != s.started.ControlSocket {
+		slog.Warn("⚠️ CONTROL_SOCKET 的修改需要重启服务才能生效", "current", s.started.ControlSocket, "configured", settings.ControlSocket)
+	}
+
+	s.daemon.Reload(settings)
+	s.metrics.Retain(settings)
+	for _, cfg := range settings.Jobs {
+		slog.Info("📋 备份任务", "job", cfg.Name, "ENV", cfg)
+	}
+	slog.Info("✅ 配置已重新加载", "jobs", len(settings.Jobs), "max_concurrent_jobs", settings.MaxConcurrentJobs)
+	return fmt.Sprintf("已重新加载 %d 个备份任务", len(settings.Jobs)), nil
+}
+
+// digestStateFile 通知汇总状态保存在第一个任务的备份目录中
+func digestStateFile(settings *config.Settings) string {
+	return filepath.Join(settings.Jobs[0].BackupDir, notify.StateFile)
 }
@@ -1,20 +1,46 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
+	"github.com/xg4/vaultwarden-backup/internal/database"
+	"github.com/xg4/vaultwarden-backup/internal/restore"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/pkg/parity"
+	"github.com/xg4/vaultwarden-backup/pkg/sign"
 )
 
 var (
-	inputFile = flag.String("input", "", "输入的加密备份文件路径 (必需)")
-	outputDir = flag.String("output", "", "输出目录路径 (必需)")
-	password  = flag.String("password", "", "解密密码 (必需)")
-	verbose   = flag.Bool("verbose", false, "启用详细输出")
-	help      = flag.Bool("help", false, "显示帮助信息")
+	inputFile  = flag.String("input", "", "输入的加密备份文件或备份目录路径 (必需)")
+	latest     = flag.Bool("latest", false, "输入为目录时，选择最新的备份")
+	at         = flag.String("at", "", "输入为目录时，选择该时间点（含）之前最新的备份，如 2026-10-01T12:00")
+	name       = flag.String("name", "", "输入为目录时，只选择该 BACKUP_NAME 前缀的备份")
+	runID      = flag.String("id", "", "输入为目录时，按备份目录文件 (catalog.jsonl) 中的运行 ID 选择备份，可只输入前几位")
+	outputDir  = flag.String("output", "", "输出目录路径 (与 -data-dir 二选一)")
+	dataDir    = flag.String("data-dir", "", "直接恢复到 Vaultwarden 数据目录 (与 -output 二选一)")
+	force      = flag.Bool("force", false, "即使检测到 Vaultwarden 正在运行也强制恢复")
+	dbURL      = flag.String("database-url", "", "-data-dir 模式下导入数据库的 DATABASE_URL (默认读取环境变量 DATABASE_URL)")
+	password   = flag.String("password", "", "解密密码 (不推荐，会暴露在 shell 历史和进程列表中)")
+	passFile   = flag.String("password-file", "", "从文件读取解密密码")
+	passStdin  = flag.Bool("password-stdin", false, "从标准输入读取解密密码")
+	publicKey  = flag.String("public-key", "", "校验归档签名的 Ed25519 公钥文件 (默认读取环境变量 PUBLIC_KEY_FILE)")
+	requireSig = flag.Bool("require-signature", false, "要求归档必须有签名并通过校验 (默认读取环境变量 REQUIRE_SIGNATURE)")
+	skipSig    = flag.Bool("skip-signature", false, "仍恢复未签名、签名不符或无法校验签名的归档")
+	verbose    = flag.Bool("verbose", false, "启用详细输出")
+	help       = flag.Bool("help", false, "显示帮助信息")
+
+	repairing bool // repair 子命令：用纠错数据修复归档，不解密
 )
 
 func init() {
@@ -28,13 +54,21 @@ func init() {
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "Vaultwarden 备份解密工具\n\n")
-	fmt.Fprintf(os.Stderr, "用法: %s [选项]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "用法: %s [restore | repair] [选项]\n\n", filepath.Base(os.Args[0]))
 	fmt.Fprintf(os.Stderr, "选项:\n")
 	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\n密码来源 (按优先级): -password, -password-file, -password-stdin, 环境变量 PASSWORD, 终端输入\n")
+	fmt.Fprintf(os.Stderr, "指定公钥或 -require-signature 后，未签名或签名不符的归档会被拒绝恢复；归档有签名但未指定公钥时同样拒绝，除非使用 -skip-signature\n")
 	fmt.Fprintf(os.Stderr, "\n示例:\n")
-	fmt.Fprintf(os.Stderr, "  %s -i backup.enc -o ./restored -p mypassword\n", filepath.Base(os.Args[0]))
-	fmt.Fprintf(os.Stderr, "  %s -input backup.enc -output ./restored -password mypassword -verbose\n", filepath.Base(os.Args[0]))
-	fmt.Fprintf(os.Stderr, "  %s -i backup.enc -o ./restored -p mypassword -v\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s -i backup.enc -o ./restored\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s -input backup.enc -output ./restored -password-file /run/secrets/password -verbose\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  echo \"$PASSWORD\" | %s -i backup.enc -o ./restored -password-stdin -v\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s restore -i backup.enc --data-dir /data\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s -i /backups --latest -o ./restored\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s -i /backups --name vault --at 2026-10-01T12:00 -o ./restored\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s -i /backups --id 3f2a9c1e -o ./restored\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s -i /backups --latest -o ./restored -public-key /run/secrets/backup.pub\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "  %s repair -i /backups/vault_20240101_120000.tar.gz\n", filepath.Base(os.Args[0]))
 }
 
 func validateArgs() error {
@@ -42,28 +76,284 @@ func validateArgs() error {
 		return fmt.Errorf("必须指定输入文件 (-input)")
 	}
 
-	if *outputDir == "" {
-		return fmt.Errorf("必须指定输出目录 (-output)")
+	if *outputDir == "" && *dataDir == "" && !repairing {
+		return fmt.Errorf("必须指定输出目录 (-output) 或数据目录 (-data-dir)")
+	}
+
+	if *outputDir != "" && *dataDir != "" {
+		return fmt.Errorf("-output 与 -data-dir 不能同时使用")
+	}
+
+	if *passFile != "" && *passStdin {
+		return fmt.Errorf("-password-file 与 -password-stdin 不能同时使用")
 	}
 
-	if *password == "" {
-		return fmt.Errorf("必须指定解密密码 (-password)")
+	if *latest && *at != "" {
+		return fmt.Errorf("-latest 与 -at 不能同时使用")
+	}
+	if *runID != "" && (*latest || *at != "" || *name != "") {
+		return fmt.Errorf("-id 不能与 -latest、-at、-name 同时使用")
+	}
+	if *requireSig && *skipSig {
+		return fmt.Errorf("-require-signature 与 -skip-signature 不能同时使用")
 	}
 
 	// 检查输入文件是否存在
-	if _, err := os.Stat(*inputFile); os.IsNotExist(err) {
+	info, err := os.Stat(*inputFile)
+	if os.IsNotExist(err) {
 		return fmt.Errorf("输入文件不存在: %s", *inputFile)
 	}
+	if err != nil {
+		return fmt.Errorf("无法访问输入文件: %w", err)
+	}
+
+	if info.IsDir() && !*latest && *at == "" && *runID == "" {
+		return fmt.Errorf("输入为目录时必须指定 -latest、-at 或 -id")
+	}
+	if !info.IsDir() && (*latest || *at != "" || *name != "" || *runID != "") {
+		return fmt.Errorf("-latest、-at、-name、-id 仅在输入为目录时可用")
+	}
 
 	return nil
 }
 
+// atLayouts -at 参数支持的时间格式，均按本地时区解析
+var atLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseAt 解析 -at 参数
+func parseAt(value string) (time.Time, error) {
+	for _, layout := range atLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间: %s", value)
+}
+
+// formatAge 将时长格式化为天/小时/分钟
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	if days > 0 {
+		return fmt.Sprintf("%d 天 %d 小时", days, hours)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%d 小时 %d 分钟", hours, minutes)
+	}
+	return fmt.Sprintf("%d 分钟", minutes)
+}
+
+// selectArchive 从备份目录中按 -id 或 -latest / -at / -name 选择归档
+func selectArchive(dir string) (archive.Entry, error) {
+	if *runID != "" {
+		return selectByID(dir)
+	}
+
+	target := time.Now()
+	if *at != "" {
+		t, err := parseAt(*at)
+		if err != nil {
+			return archive.Entry{}, err
+		}
+		target = t
+	}
+
+	entries, err := archive.List(dir, *name)
+	if err != nil {
+		return archive.Entry{}, fmt.Errorf("读取备份目录失败: %w", err)
+	}
+	if len(entries) == 0 {
+		return archive.Entry{}, fmt.Errorf("备份目录中没有找到备份: %s", dir)
+	}
+
+	if *name == "" {
+		names := map[string]bool{}
+		for _, e := range entries {
+			names[e.Name] = true
+		}
+		if len(names) > 1 {
+			list := make([]string, 0, len(names))
+			for n := range names {
+				list = append(list, n)
+			}
+			sort.Strings(list)
+			return archive.Entry{}, fmt.Errorf("备份目录中包含多个备份名称 (%s)，请使用 -name 指定", strings.Join(list, ", "))
+		}
+	}
+
+	entry, ok := archive.Select(entries, target)
+	if !ok {
+		return archive.Entry{}, fmt.Errorf("没有找到 %s 之前的备份", target.Format("2006-01-02 15:04:05"))
+	}
+	return entry, nil
+}
+
+// selectByID 按备份目录文件中的运行 ID 选择归档
+func selectByID(dir string) (archive.Entry, error) {
+	records, err := catalog.Load(dir)
+	if err != nil {
+		return archive.Entry{}, fmt.Errorf("读取备份目录文件失败: %w", err)
+	}
+	rec, err := catalog.Find(records, *runID)
+	if err != nil {
+		return archive.Entry{}, err
+	}
+	if rec.Status != catalog.StatusSuccess || rec.Archive == "" {
+		return archive.Entry{}, fmt.Errorf("运行 %s 没有生成归档 (%s)", rec.ID, rec.Error)
+	}
+
+	path := filepath.Join(dir, rec.Archive)
+	info, err := os.Stat(path)
+	if err != nil {
+		return archive.Entry{}, fmt.Errorf("运行 %s 的归档已不存在: %s", rec.ID, path)
+	}
+	return archive.Entry{Path: path, Name: rec.BackupName, Time: rec.Start, Size: info.Size()}, nil
+}
+
+// verifyChecksum 归档在备份目录文件中有记录时，检查其 SHA-256 是否与记录一致
+func verifyChecksum(file string) error {
+	records, err := catalog.Load(filepath.Dir(file))
+	if err != nil {
+		return nil
+	}
+	rec, ok := catalog.Archives(records)[filepath.Base(file)]
+	if !ok || rec.SHA256 == "" {
+		return nil
+	}
+
+	sum, err := utils.HashFile(file)
+	if err != nil {
+		return fmt.Errorf("计算校验和失败: %w", err)
+	}
+	if sum != rec.SHA256 {
+		return fmt.Errorf("归档的 SHA-256 与备份目录文件中的记录 (运行 %s) 不一致，文件可能已损坏", rec.ID)
+	}
+	if *verbose {
+		fmt.Printf("校验和与备份记录一致 (运行 %s)\n", rec.ID)
+	}
+	return nil
+}
+
+// verifySignature 校验归档的分离签名。指定了公钥时，未签名或签名不符的归档被拒绝；
+// 未指定公钥时，有签名的归档或要求签名时也会被拒绝，避免删除 .sig 或不指定公钥就绕过校验
+func verifySignature(file string) error {
+	keyFile := *publicKey
+	if keyFile == "" {
+		keyFile = os.Getenv("PUBLIC_KEY_FILE")
+	}
+	if keyFile == "" {
+		var problem string
+		if _, err := os.Stat(file + sign.Ext); err == nil {
+			problem = "归档已签名，但未指定用于校验的公钥 (-public-key 或环境变量 PUBLIC_KEY_FILE)"
+		} else if signatureRequired() {
+			problem = "要求校验签名，但未指定公钥 (-public-key 或环境变量 PUBLIC_KEY_FILE)"
+		} else {
+			return nil
+		}
+		return skipOrFail(problem)
+	}
+
+	pub, err := sign.LoadPublicKey(keyFile)
+	if err != nil {
+		return fmt.Errorf("读取公钥失败: %w", err)
+	}
+	err = sign.Verify(file, pub)
+	if err == nil {
+		if *verbose {
+			fmt.Printf("签名校验通过 (密钥 %s)\n", sign.KeyID(pub))
+		}
+		return nil
+	}
+
+	var problem string
+	switch {
+	case errors.Is(err, sign.ErrUnsigned):
+		problem = fmt.Sprintf("归档没有签名文件 %s", filepath.Base(file)+sign.Ext)
+	case errors.Is(err, sign.ErrBadSignature):
+		problem = fmt.Sprintf("签名校验失败，归档可能已被替换: %v", err)
+	default:
+		return fmt.Errorf("校验签名失败: %w", err)
+	}
+	return skipOrFail(problem)
+}
+
+// signatureRequired 判断是否通过 -require-signature 或环境变量 REQUIRE_SIGNATURE 要求签名
+func signatureRequired() bool {
+	if *requireSig {
+		return true
+	}
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_SIGNATURE"))
+	return required
+}
+
+// skipOrFail 在使用 -skip-signature 时只打印警告，否则返回签名错误
+func skipOrFail(problem string) error {
+	if *skipSig {
+		fmt.Fprintf(os.Stderr, "警告: %s，已使用 -skip-signature 继续恢复\n", problem)
+		return nil
+	}
+	return fmt.Errorf("%s\n确认归档来源可信时可使用 -skip-signature 强制恢复", problem)
+}
+
+// repairArchive 用归档旁的纠错数据重建损坏的数据块，返回退出码
+func repairArchive(file string) int {
+	if _, err := os.Stat(file + parity.Ext); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 没有找到纠错数据 %s（备份时需设置 PARITY_PERCENT）\n", file+parity.Ext)
+		return 1
+	}
+
+	result, err := parity.Repair(file)
+	if result != nil {
+		fmt.Printf("数据块: %d，损坏: %d，已修复: %d\n", result.Blocks, result.Damaged, result.Repaired)
+	}
+	if errors.Is(err, parity.ErrUnrecoverable) {
+		fmt.Fprintf(os.Stderr, "错误: 损坏的数据块超出了纠错数据的修复能力\n")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "修复失败: %v\n", err)
+		return 1
+	}
+	if result.OK() {
+		fmt.Println("归档完好，无需修复")
+		return 0
+	}
+
+	if err := verifyChecksum(file); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 1
+	}
+	fmt.Println("修复完成")
+	return 0
+}
+
+// repairHint 归档无法使用且存在纠错数据时，提示先修复
+func repairHint(file string) {
+	if _, err := os.Stat(file + parity.Ext); err == nil {
+		fmt.Fprintf(os.Stderr, "提示: 存在纠错数据，可先运行 vaultr repair -i %s 修复归档\n", file)
+	}
+}
+
 func main() {
 	// 自定义 usage 函数
 	flag.Usage = usage
 
-	// 解析命令行参数
-	flag.Parse()
+	// 解析命令行参数，restore 子命令与默认行为相同
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "restore" || args[0] == "repair") {
+		repairing = args[0] == "repair"
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	// 如果指定了 help 标志，显示帮助并退出
 	if *help {
@@ -78,6 +368,68 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 输入为目录时选择具体的归档
+	if info, _ := os.Stat(*inputFile); info.IsDir() {
+		entry, err := selectArchive(*inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("选择的备份: %s\n", entry.Path)
+		fmt.Printf("备份时间: %s (%s 前)\n", entry.Time.Format("2006-01-02 15:04:05"), formatAge(time.Since(entry.Time)))
+		fmt.Printf("文件大小: %s\n", utils.FormatBytes(entry.Size))
+		*inputFile = entry.Path
+	}
+
+	if repairing {
+		os.Exit(repairArchive(*inputFile))
+	}
+
+	if err := verifyChecksum(*inputFile); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		repairHint(*inputFile)
+		os.Exit(1)
+	}
+
+	if err := verifySignature(*inputFile); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 读取解密密码
+	if *password != "" {
+		fmt.Fprintf(os.Stderr, "警告: 通过 -password 传入的密码会暴露在 shell 历史和进程列表中，建议改用 -password-file 或 -password-stdin\n")
+	}
+	sources := secret.Sources{
+		Flag:   *password,
+		File:   *passFile,
+		Env:    "PASSWORD",
+		Prompt: "请输入解密密码: ",
+	}
+	if *passStdin {
+		sources.Stdin = os.Stdin
+	}
+	pass, err := secret.Resolve(sources)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n\n", err)
+		usage()
+		os.Exit(1)
+	}
+
+	if *dataDir != "" {
+		url, err := secret.Resolve(secret.Sources{
+			Flag: *dbURL,
+			File: os.Getenv("DATABASE_URL_FILE"),
+			Env:  "DATABASE_URL",
+		})
+		if err != nil && !errors.Is(err, secret.ErrNotProvided) {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		restoreInPlace(pass, url)
+		return
+	}
+
 	// 详细输出模式
 	if *verbose {
 		fmt.Printf("输入文件: %s\n", *inputFile)
@@ -85,16 +437,70 @@ func main() {
 		fmt.Printf("开始解密...\n")
 	}
 
-	// 执行解密
-	if err := archive.DecryptBackup(*inputFile, *password, *outputDir); err != nil {
-		fmt.Fprintf(os.Stderr, "解密归档失败: %v\n", err)
+	// 解密到暂存目录并逐个文件与归档内的清单比对，通过后移入输出目录
+	manifest, err := restore.ToDir(*inputFile, pass, *outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		repairHint(*inputFile)
 		os.Exit(1)
 	}
+	if manifest == nil {
+		fmt.Println("归档不包含清单（旧版本备份），跳过逐文件校验")
+	} else if *verbose {
+		fmt.Printf("已按清单校验 %d 个文件 (%s)\n", len(manifest.Files), manifest.Tool)
+	}
 
 	fmt.Println("Done.")
 	fmt.Println("Restore complete.")
 
+	if engine, ok := database.DetectDump(*outputDir); ok && engine != database.SQLite {
+		fmt.Printf("归档包含 %s 数据库导出文件 %s，可使用 -data-dir 模式并设置 DATABASE_URL 自动导入\n", engine, database.DumpFile(engine))
+	}
+
 	if *verbose {
 		fmt.Printf("文件已成功解密到: %s\n", *outputDir)
 	}
 }
+
+// restoreInPlace 将备份直接恢复到 Vaultwarden 数据目录
+func restoreInPlace(pass, databaseURL string) {
+	if *verbose {
+		fmt.Printf("输入文件: %s\n", *inputFile)
+		fmt.Printf("数据目录: %s\n", *dataDir)
+	}
+
+	if err := restore.CheckNotRunning(*dataDir); err != nil {
+		if !*force {
+			fmt.Fprintf(os.Stderr, "错误: %v\n请先停止 Vaultwarden，或使用 -force 强制恢复\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "警告: %v，已使用 -force 继续恢复\n", err)
+	}
+
+	result, err := restore.InPlace(restore.Options{
+		ArchiveFile: *inputFile,
+		Password:    pass,
+		DataDir:     *dataDir,
+		DatabaseURL: databaseURL,
+		Force:       *force,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "恢复失败: %v\n", err)
+		repairHint(*inputFile)
+		os.Exit(1)
+	}
+
+	if *verbose {
+		fmt.Printf("数据库类型: %s %s\n", result.Engine, result.Version)
+		for _, name := range result.Restored {
+			fmt.Printf("已恢复: %s\n", name)
+		}
+	}
+
+	if result.Manifest == nil {
+		fmt.Println("归档不包含清单（旧版本备份），已跳过逐文件校验")
+	}
+
+	fmt.Println("恢复完成")
+	fmt.Printf("原数据已保存到: %s\n", result.RollbackDir)
+}
@@ -1,13 +1,26 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/database"
+	"github.com/xg4/vaultwarden-backup/internal/logger"
+	"github.com/xg4/vaultwarden-backup/internal/ping"
+	"github.com/xg4/vaultwarden-backup/internal/report"
 	"github.com/xg4/vaultwarden-backup/internal/scheduler"
+	"github.com/xg4/vaultwarden-backup/internal/selection"
 	"github.com/xg4/vaultwarden-backup/internal/tasks"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/internal/vaultwarden"
 )
 
 // App 备份应用主体，管理整个备份流程
@@ -22,52 +35,153 @@ func New(cfg *config.Config) *App {
 	}
 }
 
-// Run 执行完整的备份流程：检查 -> 备份 -> 打包 -> 清理
-func (a *App) Run() error {
-	startTime := time.Now()
+// Run 执行完整的备份流程：检查 -> 备份 -> 打包 -> 清理，返回本次运行的报告
+func (a *App) Run(ctx context.Context) (rep *report.Report, err error) {
+	rep = report.New(a.cfg.Name, a.cfg.BackupName)
+	ctx = report.NewContext(ctx, rep)
+	// 本次运行中通过 slog.*Context 记录的日志都带有 run_id 和 job
+	ctx = logger.With(ctx, "run_id", rep.ID, "job", a.cfg.Name)
+	ping.Start(ctx, a.cfg, rep)
+	defer func() {
+		rep.Finish(err)
+		if err := catalog.Append(a.cfg.BackupDir, catalog.FromReport(rep.Snapshot())); err != nil {
+			slog.WarnContext(ctx, "⚠️ 写入备份目录文件失败", "error", err)
+		}
+		ping.Finish(ctx, a.cfg, rep)
+	}()
+
+	startTime := rep.Start
 
-	timestamp := startTime.Format("20060102_150405")
-	slog.Info("🚀 开始备份", "timestamp", timestamp)
+	timestamp := startTime.Format(archive.TimestampLayout)
+	slog.InfoContext(ctx, "🚀 开始备份", "timestamp", timestamp)
+
+	p, err := a.plan()
+	if err != nil {
+		slog.ErrorContext(ctx, "🚨 生成备份计划失败", "error", err)
+		return rep, err
+	}
+	slog.InfoContext(ctx, "🗺️ 备份计划", "layout", p.layout)
 
 	s := scheduler.New(a.cfg)
 
 	// 阶段1: 环境检查和准备
 	s.Register(
-		&tasks.CheckDataDir{},       // 检查数据目录是否存在
-		&tasks.CheckDiskSpace{},     // 检查磁盘空间是否充足
+		&tasks.CheckDataDir{}, // 检查数据目录是否存在
+		&tasks.CheckDiskSpace{ // 检查磁盘空间是否充足
+			Items:    p.items,
+			Selector: p.selector,
+			Extra:    p.extra,
+		},
 		&tasks.CreateBackupTmpDir{}, // 创建临时备份目录
 	)
 
-	// 阶段2: 执行数据备份任务
-	s.Register(
-		&tasks.DatabaseTask{},                // 备份 SQLite 数据库
-		&tasks.RSATask{},                     // 备份 RSA 密钥文件
-		&tasks.CopyTask{Path: ".env"},        // 备份环境配置文件
-		&tasks.CopyTask{Path: "config.json"}, // 备份应用配置文件
-		&tasks.CopyTask{Path: "attachments"}, // 备份附件目录
-		&tasks.CopyTask{Path: "sends"},       // 备份发送文件目录
-	)
+	// 阶段2: 执行数据备份任务：数据库和 RSA 密钥始终备份，其余条目按 INCLUDE/EXCLUDE 规则复制
+	backupTasks := []scheduler.Task{
+		&tasks.DatabaseTask{URL: p.layout.DatabaseURL}, // 备份数据库
+		&tasks.RSATask{Prefix: p.layout.RSAKey},        // 备份 RSA 密钥文件
+	}
+	for _, item := range p.items {
+		backupTasks = append(backupTasks, &tasks.CopyTask{Path: item.Path, Src: item.Src, Selector: p.selector})
+	}
+	s.Register(backupTasks...)
 
 	// 阶段3: 打包压缩和加密
 	s.Register(&tasks.ArchiveTask{
 		Timestamp: timestamp,
 	})
+	if a.cfg.SigningKeyFile != "" {
+		s.Register(&tasks.SignTask{Timestamp: timestamp})
+	}
+	if a.cfg.ParityPercent > 0 {
+		s.Register(&tasks.ParityTask{Timestamp: timestamp})
+	}
 
 	// 阶段4: 清理过期备份
 	s.Register(&tasks.CleanupTask{})
 
 	// 确保临时目录在函数结束时被清理
 	defer func() {
-		slog.Debug("🧽 清理临时文件", "tmpDir", a.cfg.TmpDir)
+		slog.DebugContext(ctx, "🧽 清理临时文件", "tmpDir", a.cfg.TmpDir)
 		os.RemoveAll(a.cfg.TmpDir)
 	}()
 
-	if err := s.Start(); err != nil {
-		slog.Error("🚨 备份失败", "error", err)
-		return err
+	if err := s.Start(ctx); err != nil {
+		slog.ErrorContext(ctx, "🚨 备份失败", "error", err)
+		return rep, err
 	}
 
 	duration := time.Since(startTime)
-	slog.Info("✅ 备份完成", "duration", duration)
+	slog.InfoContext(ctx, "✅ 备份完成", "duration", duration)
+	return rep, nil
+}
+
+// plan 一次备份的计划：解析后的数据位置、可备份条目和选择规则
+type plan struct {
+	layout   *vaultwarden.Layout
+	items    []selection.Item
+	selector *selection.Selector
+	extra    []string // 由专门任务备份的文件：SQLite 数据库和 RSA 密钥
+}
+
+// plan 从 Vaultwarden 自身的配置中解析数据实际所在的位置，并结合 INCLUDE/EXCLUDE 规则生成备份计划
+func (a *App) plan() (*plan, error) {
+	layout, err := vaultwarden.Discover(a.cfg.DataDir, a.cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Vaultwarden 配置失败: %w", err)
+	}
+
+	selector, err := selection.New(a.cfg.Include, a.cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := layout.Items(a.cfg.BackupDir, a.cfg.TmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	extra, _ := filepath.Glob(layout.RSAKey + "*")
+	if url := layout.DatabaseURL.Reveal(); database.Detect(url) == database.SQLite {
+		extra = append([]string{url}, extra...)
+	}
+
+	return &plan{layout: layout, items: items, selector: selector, extra: extra}, nil
+}
+
+// DryRun 打印备份计划和将要复制的文件列表，不执行备份
+func (a *App) DryRun(w io.Writer) error {
+	p, err := a.plan()
+	if err != nil {
+		return err
+	}
+
+	db := p.layout.DatabaseURL.String()
+	engine := database.Detect(p.layout.DatabaseURL.Reveal())
+	if engine == database.SQLite {
+		db = p.layout.DatabaseURL.Reveal()
+	}
+	fmt.Fprintf(w, "数据库 (%s): %s\n", engine, db)
+
+	var count int
+	var total int64
+	for _, file := range p.extra {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(w, "%s (%s)\n", file, utils.FormatBytes(info.Size()))
+			count++
+			total += info.Size()
+		}
+	}
+
+	err = p.selector.Walk(p.items, func(rel, src string, info os.FileInfo) error {
+		fmt.Fprintf(w, "%s <- %s (%s)\n", filepath.ToSlash(rel), src, utils.FormatBytes(info.Size()))
+		count++
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "共 %d 个文件，%s\n", count, utils.FormatBytes(total))
 	return nil
 }
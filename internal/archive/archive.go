@@ -1,6 +1,10 @@
 package archive
 
 import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -9,8 +13,18 @@ import (
 	"github.com/xg4/vaultwarden-backup/pkg/targz"
 )
 
-// EncryptedBackup creates an encrypted tar.gz archive of the specified directory.
-func EncryptedBackup(backupDir, password, archiveFile string) error {
+// EncryptedBackup creates an encrypted, compressed tar archive of the specified directory.
+// A non-nil manifest is written as the first entry of the archive.
+func EncryptedBackup(backupDir, password, archiveFile string, comp targz.Compression, manifest *Manifest) error {
+	var leading []targz.Entry
+	if manifest != nil {
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		leading = append(leading, targz.Entry{Name: ManifestName, Data: data})
+	}
+
 	outFile, err := os.Create(archiveFile)
 	if err != nil {
 		return fmt.Errorf("failed to create archive file: %w", err)
@@ -21,8 +35,8 @@ func EncryptedBackup(backupDir, password, archiveFile string) error {
 
 	go func() {
 		defer pipeWriter.Close()
-		if err := targz.Create(backupDir, pipeWriter); err != nil {
-			pipeWriter.CloseWithError(fmt.Errorf("failed to create tar.gz archive: %w", err))
+		if err := targz.Create(backupDir, pipeWriter, comp, leading...); err != nil {
+			pipeWriter.CloseWithError(fmt.Errorf("failed to create tar archive: %w", err))
 		}
 	}()
 
@@ -51,8 +65,76 @@ func DecryptBackup(archiveFile, password, extractDir string) error {
 	}()
 
 	if err := targz.Extract(pipeReader, extractDir); err != nil {
-		return fmt.Errorf("failed to extract tar.gz archive: %w", err)
+		return fmt.Errorf("failed to extract tar archive: %w", err)
 	}
 
 	return nil
 }
+
+// VerifyBackup decrypts the archive and reads the tar stream, hashing every entry on the fly
+// without writing anything to disk. Decryption holds the archive in memory (see
+// crypto.DecryptStream), so it needs about twice the archive size in RAM. Entries are compared with want, or with the manifest
+// stored in the archive when want is nil. It returns the stored manifest, which is nil for
+// archives written before manifests were introduced; such archives are only checked for
+// decryption and tar structure errors.
+func VerifyBackup(archiveFile, password string, want *Manifest) (*Manifest, []Mismatch, error) {
+	inFile, err := os.Open(archiveFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer inFile.Close()
+
+	return VerifyStream(inFile, password, want)
+}
+
+// VerifyStream is VerifyBackup for an archive read from r.
+func VerifyStream(r io.Reader, password string, want *Manifest) (*Manifest, []Mismatch, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeReader.Close()
+
+	go func() {
+		defer pipeWriter.Close()
+		if err := crypto.DecryptStream(r, pipeWriter, password); err != nil {
+			pipeWriter.CloseWithError(fmt.Errorf("failed to decrypt archive: %w", err))
+		}
+	}()
+
+	var (
+		stored  *Manifest
+		found   = map[string]ManifestFile{}
+		entries int
+	)
+	err := targz.Walk(pipeReader, func(header *tar.Header, content io.Reader) error {
+		entries++
+		if entries == 1 && header.Name == ManifestName {
+			m, err := decodeManifest(content)
+			if err != nil {
+				return err
+			}
+			stored = m
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		h := sha256.New()
+		size, err := io.Copy(h, content)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		found[header.Name] = ManifestFile{Path: header.Name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read tar archive: %w", err)
+	}
+
+	if want == nil {
+		want = stored
+	}
+	if want == nil {
+		return nil, nil, nil
+	}
+	return stored, want.compare(found), nil
+}
@@ -0,0 +1,150 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+)
+
+// ManifestName is the name of the manifest, written as the first entry of every archive.
+const ManifestName = "MANIFEST.json"
+
+// manifestFormat is the current manifest format version.
+const manifestFormat = 1
+
+// Manifest describes the contents of an archive and where it came from.
+type Manifest struct {
+	Format     int               `json:"format"`
+	Tool       string            `json:"tool"` // program name and version that wrote the archive
+	Created    time.Time         `json:"created"`
+	Host       string            `json:"host"`
+	Job        string            `json:"job,omitempty"`
+	BackupName string            `json:"backup_name,omitempty"`
+	DataDir    string            `json:"data_dir"` // Vaultwarden data directory that was backed up
+	Database   *ManifestDatabase `json:"database,omitempty"`
+	Files      []ManifestFile    `json:"files"`
+}
+
+// ManifestDatabase records the database the dump was taken from.
+type ManifestDatabase struct {
+	Engine  string `json:"engine"`
+	Version string `json:"version"`
+}
+
+// ManifestFile describes one regular file in the archive.
+type ManifestFile struct {
+	Path   string    `json:"path"` // slash-separated path relative to the archive root
+	Size   int64     `json:"size"`
+	Mode   string    `json:"mode"` // permission bits in octal, e.g. 0644
+	MTime  time.Time `json:"mtime"`
+	SHA256 string    `json:"sha256"`
+}
+
+// Mismatch describes a file that does not match the manifest.
+type Mismatch struct {
+	Path    string
+	Problem string
+}
+
+func (m Mismatch) String() string {
+	return m.Path + ": " + m.Problem
+}
+
+// ManifestFiles lists every regular file under dir with its size, mode, mtime and SHA-256, sorted by path.
+func ManifestFiles(dir string) ([]ManifestFile, error) {
+	var files []ManifestFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := utils.HashFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, ManifestFile{
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			Mode:   fmt.Sprintf("%04o", info.Mode().Perm()),
+			MTime:  info.ModTime().UTC().Truncate(time.Second),
+			SHA256: sum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// NewManifest returns a manifest for the given files, stamped with the current time and host.
+func NewManifest(files []ManifestFile) *Manifest {
+	host, _ := os.Hostname()
+	return &Manifest{Format: manifestFormat, Created: time.Now().UTC(), Host: host, Files: files}
+}
+
+// ReadManifest reads MANIFEST.json from an extracted archive. It returns an error
+// wrapping os.ErrNotExist for archives written before manifests were introduced.
+func ReadManifest(dir string) (*Manifest, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeManifest(f)
+}
+
+func decodeManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestName, err)
+	}
+	return &m, nil
+}
+
+// VerifyDir compares the files extracted into dir with the manifest and returns every
+// file that is missing, differs in size or content, or is not listed in the manifest.
+func (m *Manifest) VerifyDir(dir string) ([]Mismatch, error) {
+	actual, err := ManifestFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]ManifestFile, len(actual))
+	for _, f := range actual {
+		found[f.Path] = f
+	}
+	delete(found, ManifestName)
+	return m.compare(found), nil
+}
+
+// compare checks the files found in an archive, keyed by path, against the manifest.
+func (m *Manifest) compare(found map[string]ManifestFile) []Mismatch {
+	var mismatches []Mismatch
+	for _, want := range m.Files {
+		got, ok := found[want.Path]
+		delete(found, want.Path)
+		switch {
+		case !ok:
+			mismatches = append(mismatches, Mismatch{want.Path, "missing"})
+		case got.Size != want.Size:
+			mismatches = append(mismatches, Mismatch{want.Path, fmt.Sprintf("size %d, expected %d", got.Size, want.Size)})
+		case got.SHA256 != want.SHA256:
+			mismatches = append(mismatches, Mismatch{want.Path, "sha256 mismatch"})
+		}
+	}
+	for path := range found {
+		mismatches = append(mismatches, Mismatch{path, "not listed in manifest"})
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Path < mismatches[j].Path })
+	return mismatches
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/pkg/targz"
+)
+
+// TimestampLayout is the time format embedded in archive file names.
+const TimestampLayout = "20060102_150405"
+
+// Entry describes an archive found in a backup directory.
+type Entry struct {
+	Path string    // full path of the archive
+	Name string    // BACKUP_NAME prefix
+	Time time.Time // backup time parsed from the file name
+	Size int64     // file size in bytes
+}
+
+// FileName returns the archive file name for the given backup name and timestamp.
+// The extension follows the compression, e.g. .tar.gz or .tar.zst.
+func FileName(name, timestamp string, comp targz.Compression) string {
+	return fmt.Sprintf("%s_%s%s", name, timestamp, comp.Ext())
+}
+
+// ParseFileName extracts the backup name and time from an archive file name.
+func ParseFileName(base string) (string, time.Time, bool) {
+	var stem string
+	ok := false
+	for _, ext := range targz.Exts() {
+		if stem, ok = strings.CutSuffix(base, ext); ok {
+			break
+		}
+	}
+	if !ok || len(stem) < len(TimestampLayout)+2 {
+		return "", time.Time{}, false
+	}
+
+	sep := len(stem) - len(TimestampLayout) - 1
+	if stem[sep] != '_' {
+		return "", time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation(TimestampLayout, stem[sep+1:], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return stem[:sep], t, true
+}
+
+// List returns the archives in dir, oldest first. An empty name matches every prefix.
+func List(dir, name string) ([]Entry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, de := range dirEntries {
+		if de.IsDir() {
+			continue
+		}
+		prefix, t, ok := ParseFileName(de.Name())
+		if !ok || (name != "" && prefix != name) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{
+			Path: filepath.Join(dir, de.Name()),
+			Name: prefix,
+			Time: t,
+			Size: info.Size(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// Select returns the newest archive taken at or before at.
+func Select(entries []Entry, at time.Time) (Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Time.After(at) {
+			return entries[i], true
+		}
+	}
+	return Entry{}, false
+}
@@ -0,0 +1,278 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/report"
+)
+
+// FileName 备份目录中目录文件的名称，每行一条 JSON 记录
+const FileName = "catalog.jsonl"
+
+// maxRecords 清理后最多保留的没有归档的记录数，避免任务持续失败时记录无限增长
+const maxRecords = 1000
+
+// 运行结果
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// Record 一次备份运行的记录
+type Record struct {
+	ID           string              `json:"id"`
+	Job          string              `json:"job"`
+	BackupName   string              `json:"backup_name"`
+	Status       string              `json:"status"`
+	Start        time.Time           `json:"start"`
+	End          time.Time           `json:"end"`
+	Archive      string              `json:"archive,omitempty"` // 归档文件名，位于目录文件所在的备份目录
+	Size         int64               `json:"size,omitempty"`
+	SHA256       string              `json:"sha256,omitempty"`
+	Destinations []string            `json:"destinations,omitempty"` // 归档的存放位置
+	Files        int64               `json:"files,omitempty"`
+	Bytes        int64               `json:"bytes,omitempty"`
+	DBEngine     string              `json:"db_engine,omitempty"`
+	DBVersion    string              `json:"db_version,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	Tasks        []report.TaskResult `json:"tasks,omitempty"`
+	Pruned       []string            `json:"pruned,omitempty"` // 本次清理掉的旧归档文件名
+}
+
+// FromReport 根据运行报告生成记录
+func FromReport(rep *report.Report) Record {
+	rec := Record{
+		ID:         rep.ID,
+		Job:        rep.Job,
+		BackupName: rep.BackupName,
+		Status:     StatusSuccess,
+		Start:      rep.Start,
+		End:        rep.End,
+		Size:       rep.ArchiveSize,
+		SHA256:     rep.Checksum,
+		Files:      rep.Files,
+		Bytes:      rep.Bytes,
+		DBEngine:   rep.DBEngine,
+		DBVersion:  rep.DBVersion,
+		Error:      rep.Error,
+		Tasks:      rep.Tasks,
+	}
+	if rep.Error != "" {
+		rec.Status = StatusFailure
+	}
+	if rep.Archive != "" {
+		rec.Archive = filepath.Base(rep.Archive)
+		rec.Destinations = []string{rep.Archive}
+	}
+	for _, p := range rep.Pruned {
+		rec.Pruned = append(rec.Pruned, filepath.Base(p))
+	}
+	return rec
+}
+
+// Duration 返回运行时长
+func (r Record) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// mu 同一进程内多个任务可能共用一个备份目录，串行写入目录文件
+var mu sync.Mutex
+
+// Append 将记录追加到 dir 中的目录文件
+func Append(dir string, rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return appendLines(filepath.Join(dir, FileName), append(line, '\n'))
+}
+
+// appendLines 将若干行追加到 path；上次写入中断留下不完整的最后一行时先补上换行，
+// 避免新记录接在残行后面而无法解析。调用方需持有 mu
+func appendLines(path string, lines []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			f.Close()
+			return err
+		}
+		if last[0] != '\n' {
+			lines = append([]byte{'\n'}, lines...)
+		}
+	}
+	if _, err := f.Write(lines); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite 重写 path，只保留 keep 返回 true 的行，空行一并去掉；keep 按文件中的顺序调用。
+// 没有需要删除的行时不改动文件，文件不存在时返回 0。先写入临时文件再替换，写入中断不会损坏原文件
+func rewrite(path string, keep func(lines [][]byte) []bool) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	kept := keep(lines)
+
+	var out []byte
+	removed := 0
+	for i, line := range lines {
+		if kept[i] {
+			out = append(append(out, line...), '\n')
+		} else {
+			removed++
+		}
+	}
+	if removed == 0 && len(out) == len(data) {
+		return 0, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return removed, os.Rename(tmp, path)
+}
+
+// Prune 删除 dir 中目录文件里已失去意义的记录，返回删除的记录数：
+//   - 归档文件已不在 dir 中（被清理或手动删除）的记录
+//   - 没有归档、且早于同一任务最旧的现存归档的记录（如早已过了保留期的失败运行）
+//   - 没有归档的记录超过 maxRecords 条时最早的部分
+//
+// 无法解析的行（如写入中断留下的残行）也会被删除
+func Prune(dir string) (int, error) {
+	return rewrite(filepath.Join(dir, FileName), func(lines [][]byte) []bool {
+		records := make([]*Record, len(lines))
+		oldest := map[string]time.Time{} // 每个任务最旧的现存归档的开始时间
+		for i, line := range lines {
+			var rec Record
+			if json.Unmarshal(line, &rec) != nil || rec.ID == "" {
+				continue
+			}
+			if rec.Archive != "" {
+				if _, err := os.Stat(filepath.Join(dir, rec.Archive)); err != nil {
+					continue
+				}
+				if t, ok := oldest[rec.Job]; !ok || rec.Start.Before(t) {
+					oldest[rec.Job] = rec.Start
+				}
+			}
+			records[i] = &rec
+		}
+
+		kept := make([]bool, len(lines))
+		var bare []int // 保留的没有归档的记录
+		for i, rec := range records {
+			switch {
+			case rec == nil:
+			case rec.Archive != "":
+				kept[i] = true
+			case !rec.Start.Before(oldest[rec.Job]):
+				bare = append(bare, i)
+			}
+		}
+		sort.SliceStable(bare, func(a, b int) bool { return records[bare[a]].Start.After(records[bare[b]].Start) })
+		for n, i := range bare {
+			kept[i] = n < maxRecords
+		}
+		return kept
+	})
+}
+
+// Load 读取 dir 中的目录文件，按开始时间排序；文件不存在时返回空列表，无法解析的行（如写入中断）会被跳过
+func Load(dir string) ([]Record, error) {
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil && rec.ID != "" {
+			records = append(records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+	return records, nil
+}
+
+// Find 按 ID 或唯一的 ID 前缀查找记录
+func Find(records []Record, id string) (Record, error) {
+	var found []Record
+	for _, rec := range records {
+		if rec.ID == id {
+			return rec, nil
+		}
+		if strings.HasPrefix(rec.ID, id) {
+			found = append(found, rec)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Record{}, fmt.Errorf("未找到记录: %s", id)
+	case 1:
+		return found[0], nil
+	default:
+		return Record{}, fmt.Errorf("ID 前缀 %s 匹配到 %d 条记录，请输入更长的 ID", id, len(found))
+	}
+}
+
+// Archives 返回成功运行生成的归档，键为归档文件名
+func Archives(records []Record) map[string]Record {
+	archives := map[string]Record{}
+	for _, rec := range records {
+		if rec.Status == StatusSuccess && rec.Archive != "" {
+			archives[rec.Archive] = rec
+		}
+	}
+	return archives
+}
@@ -0,0 +1,327 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// at 返回 base 之后第 n 天的时间
+func at(n int) time.Time {
+	return base.AddDate(0, 0, n)
+}
+
+// touch 在 dir 中创建归档文件
+func touch(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("archive"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ids 返回记录的 ID 列表
+func ids(records []Record) string {
+	var list []string
+	for _, rec := range records {
+		list = append(list, rec.ID)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if records, err := Load(dir); err != nil || records != nil {
+		t.Fatalf("Load on an empty directory = %v, %v", records, err)
+	}
+
+	// 按开始时间排序，而不是写入顺序
+	for _, rec := range []Record{
+		{ID: "b", Job: "vault", Status: StatusSuccess, Start: at(2), Archive: "vault_b.tar.gz"},
+		{ID: "a", Job: "vault", Status: StatusFailure, Start: at(1), Error: "磁盘空间不足"},
+		{ID: "c", Job: "vault", Status: StatusSuccess, Start: at(3), Archive: "vault_c.tar.gz"},
+	} {
+		if err := Append(dir, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(records); got != "a,b,c" {
+		t.Errorf("Load = %s, want a,b,c", got)
+	}
+	if records[0].Error != "磁盘空间不足" || records[0].Status != StatusFailure {
+		t.Errorf("record a = %+v", records[0])
+	}
+}
+
+func TestLoadTornLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	if err := Append(dir, Record{ID: "a", Start: at(1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟写入中断：最后一行不完整且没有换行
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"id":"b","job":"vau`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(records); got != "a" {
+		t.Errorf("Load = %s, want the torn line skipped", got)
+	}
+
+	// 之后追加的记录不会接在残行后面
+	if err := Append(dir, Record{ID: "c", Start: at(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(records); got != "a,c" {
+		t.Errorf("Load after append = %s, want a,c", got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	records := []Record{{ID: "3f2a9c1e"}, {ID: "3f2b0000"}, {ID: "3f2a"}, {ID: "77aa0011"}}
+	tests := []struct {
+		id   string
+		want string
+		err  string
+	}{
+		{id: "77aa0011", want: "77aa0011"},
+		{id: "77", want: "77aa0011"},
+		{id: "3f2a9", want: "3f2a9c1e"},
+		{id: "3f2a", want: "3f2a"}, // 完全匹配优先于前缀
+		{id: "3f2", err: "匹配到 3 条记录"},
+		{id: "ffff", err: "未找到记录"},
+	}
+	for _, tt := range tests {
+		rec, err := Find(records, tt.id)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Find(%q) = %v, %v, want error %q", tt.id, rec.ID, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || rec.ID != tt.want {
+			t.Errorf("Find(%q) = %v, %v, want %s", tt.id, rec.ID, err, tt.want)
+		}
+	}
+}
+
+func TestArchives(t *testing.T) {
+	archives := Archives([]Record{
+		{ID: "a", Status: StatusSuccess, Archive: "vault_a.tar.gz"},
+		{ID: "b", Status: StatusFailure, Archive: "vault_b.tar.gz"},
+		{ID: "c", Status: StatusFailure},
+	})
+	if len(archives) != 1 || archives["vault_a.tar.gz"].ID != "a" {
+		t.Errorf("Archives = %v, want only the successful run", archives)
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	checks := []Check{
+		// 损坏后再次巡检无法完成：仍视为损坏
+		{Archive: "a.tar.gz", Time: at(1), Status: CheckCorrupt, Problem: "认证失败"},
+		{Archive: "a.tar.gz", Time: at(2), Status: CheckError, Problem: "读取失败"},
+		// 修复后巡检通过：不再视为损坏
+		{Archive: "b.tar.gz", Time: at(1), Status: CheckCorrupt},
+		{Archive: "b.tar.gz", Time: at(3), Status: CheckOK},
+		// 写入顺序与时间顺序不同
+		{Archive: "c.tar.gz", Time: at(5), Status: CheckCorrupt},
+		{Archive: "c.tar.gz", Time: at(4), Status: CheckOK},
+		{Archive: "d.tar.gz", Time: at(1), Status: CheckError},
+	}
+	if err := AppendChecks(dir, checks); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadChecks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := Corrupted(loaded)
+	if len(corrupted) != 2 {
+		t.Errorf("Corrupted = %v, want a and c", corrupted)
+	}
+	if c, ok := corrupted["a.tar.gz"]; !ok || c.Problem != "认证失败" {
+		t.Errorf("a.tar.gz = %+v, %v", c, ok)
+	}
+	if _, ok := corrupted["c.tar.gz"]; !ok {
+		t.Error("c.tar.gz is not reported as corrupted")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "vault_3.tar.gz", "vault_5.tar.gz", "other_1.tar.gz")
+	for _, rec := range []Record{
+		{ID: "fail-0", Job: "vault", Status: StatusFailure, Start: at(0)},
+		{ID: "ok-1", Job: "vault", Status: StatusSuccess, Start: at(1), Archive: "vault_1.tar.gz"}, // 已被清理
+		{ID: "fail-2", Job: "vault", Status: StatusFailure, Start: at(2)},
+		{ID: "ok-3", Job: "vault", Status: StatusSuccess, Start: at(3), Archive: "vault_3.tar.gz"},
+		{ID: "fail-4", Job: "vault", Status: StatusFailure, Start: at(4)},
+		{ID: "ok-5", Job: "vault", Status: StatusSuccess, Start: at(5), Archive: "vault_5.tar.gz"},
+		// 另一个任务最旧的归档更早，它的失败记录按自己的归档判断
+		{ID: "other-fail-0", Job: "other", Status: StatusFailure, Start: at(0)},
+		{ID: "other-ok-1", Job: "other", Status: StatusSuccess, Start: at(1), Archive: "other_1.tar.gz"},
+		{ID: "other-fail-2", Job: "other", Status: StatusFailure, Start: at(2)},
+		// 没有任何现存归档的任务保留失败记录
+		{ID: "new-fail-1", Job: "new", Status: StatusFailure, Start: at(1)},
+	} {
+		if err := Append(dir, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{\"id\":\"torn")
+	f.Close()
+
+	n, err := Prune(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("Prune removed %d lines, want 5", n)
+	}
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "other-ok-1,new-fail-1,other-fail-2,ok-3,fail-4,ok-5"
+	if got := ids(records); got != want {
+		t.Errorf("records = %s, want %s", got, want)
+	}
+
+	// 没有需要删除的记录时不改动文件
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Prune(dir); err != nil || n != 0 {
+		t.Errorf("second Prune = %d, %v", n, err)
+	}
+	if again, err := os.Stat(filepath.Join(dir, FileName)); err != nil || !os.SameFile(info, again) {
+		t.Error("catalog was rewritten without changes")
+	}
+
+	if n, err := Prune(t.TempDir()); err != nil || n != 0 {
+		t.Errorf("Prune without a catalog = %d, %v", n, err)
+	}
+}
+
+func TestPruneLimit(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < maxRecords+10; i++ {
+		rec := Record{ID: fmt.Sprintf("fail-%04d", i), Job: "vault", Status: StatusFailure, Start: base.Add(time.Duration(i) * time.Hour)}
+		if err := Append(dir, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(t, dir, "vault_0.tar.gz")
+	if err := Append(dir, Record{ID: "ok", Job: "vault", Status: StatusSuccess, Start: base.Add(-time.Hour), Archive: "vault_0.tar.gz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Prune(dir); err != nil {
+		t.Fatal(err)
+	}
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只限制没有归档的记录，现存归档的记录始终保留
+	if len(records) != maxRecords+1 {
+		t.Fatalf("%d records, want %d", len(records), maxRecords+1)
+	}
+	if records[0].ID != "ok" || records[1].ID != "fail-0010" {
+		t.Errorf("oldest records = %s, %s, want ok, fail-0010", records[0].ID, records[1].ID)
+	}
+}
+
+func TestPruneChecks(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "a.tar.gz", "b.tar.gz", "c.tar.gz")
+	checks := []Check{
+		{Archive: "a.tar.gz", Time: at(1), Status: CheckOK},
+		{Archive: "a.tar.gz", Time: at(2), Status: CheckCorrupt},
+		{Archive: "a.tar.gz", Time: at(3), Status: CheckError}, // 最近结论之后的结果保留
+		{Archive: "b.tar.gz", Time: at(1), Status: CheckError},
+		{Archive: "b.tar.gz", Time: at(2), Status: CheckError},
+		{Archive: "c.tar.gz", Time: at(2), Status: CheckOK},
+		{Archive: "c.tar.gz", Time: at(1), Status: CheckCorrupt},
+		{Archive: "gone.tar.gz", Time: at(1), Status: CheckCorrupt},
+	}
+	if err := AppendChecks(dir, checks); err != nil {
+		t.Fatal(err)
+	}
+	before, err := LoadChecks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := PruneChecks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("PruneChecks removed %d lines, want 3", n)
+	}
+	after, err := LoadChecks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range after {
+		got = append(got, fmt.Sprintf("%s@%d", c.Archive, c.Time.Sub(base)/(24*time.Hour)))
+	}
+	want := "b.tar.gz@1,a.tar.gz@2,b.tar.gz@2,c.tar.gz@2,a.tar.gz@3"
+	if strings.Join(got, ",") != want {
+		t.Errorf("checks = %s, want %s", strings.Join(got, ","), want)
+	}
+
+	// 清理不改变仍存在的归档的巡检结论
+	wantCorrupted := Corrupted(before)
+	delete(wantCorrupted, "gone.tar.gz")
+	gotCorrupted := Corrupted(after)
+	if len(gotCorrupted) != len(wantCorrupted) {
+		t.Errorf("Corrupted = %v, want %v", gotCorrupted, wantCorrupted)
+	}
+	for name := range wantCorrupted {
+		if _, ok := gotCorrupted[name]; !ok {
+			t.Errorf("%s is no longer reported as corrupted", name)
+		}
+	}
+}
+
+func TestAppendUnwritable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	if err := Append(dir, Record{ID: "a"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Append = %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ScrubFileName 备份目录中巡检记录文件的名称，每行一条 JSON 记录
+const ScrubFileName = "scrub.jsonl"
+
+// 归档的巡检结果
+const (
+	CheckOK      = "ok"
+	CheckCorrupt = "corrupt" // 校验和、认证标签、tar 结构或清单不一致
+	CheckError   = "error"   // 无法完成检查，如读取失败或密码已更改，不视为损坏
+)
+
+// Check 一次巡检中单个归档的结果
+type Check struct {
+	RunID   string    `json:"run_id"`
+	Job     string    `json:"job"`
+	Archive string    `json:"archive"` // 归档文件名，位于记录文件所在的备份目录
+	Time    time.Time `json:"time"`
+	Status  string    `json:"status"`
+	Problem string    `json:"problem,omitempty"`
+}
+
+// AppendChecks 将巡检结果追加到 dir 中的巡检记录文件
+func AppendChecks(dir string, checks []Check) error {
+	var lines []byte
+	for _, c := range checks {
+		line, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return appendLines(filepath.Join(dir, ScrubFileName), lines)
+}
+
+// PruneChecks 删除 dir 中巡检记录里已失去意义的结果，返回删除的记录数：归档文件已不在 dir 中的结果，
+// 以及每个归档最近一次得出结论（完好或损坏）之前的结果。无法解析的行也会被删除
+func PruneChecks(dir string) (int, error) {
+	return rewrite(filepath.Join(dir, ScrubFileName), func(lines [][]byte) []bool {
+		checks := make([]*Check, len(lines))
+		latest := map[string]time.Time{} // 每个归档最近一次得出结论的时间
+		exists := map[string]bool{}
+		for i, line := range lines {
+			var c Check
+			if json.Unmarshal(line, &c) != nil || c.Archive == "" {
+				continue
+			}
+			if _, ok := exists[c.Archive]; !ok {
+				_, err := os.Stat(filepath.Join(dir, c.Archive))
+				exists[c.Archive] = err == nil
+			}
+			if c.Status != CheckError && c.Time.After(latest[c.Archive]) {
+				latest[c.Archive] = c.Time
+			}
+			checks[i] = &c
+		}
+
+		kept := make([]bool, len(lines))
+		for i, c := range checks {
+			kept[i] = c != nil && exists[c.Archive] && !c.Time.Before(latest[c.Archive])
+		}
+		return kept
+	})
+}
+
+// LoadChecks 读取 dir 中的巡检记录，按时间排序；文件不存在时返回空列表，无法解析的行会被跳过
+func LoadChecks(dir string) ([]Check, error) {
+	f, err := os.Open(filepath.Join(dir, ScrubFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var checks []Check
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c Check
+		if json.Unmarshal(scanner.Bytes(), &c) == nil && c.Archive != "" {
+			checks = append(checks, c)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].Time.Before(checks[j].Time) })
+	return checks, nil
+}
+
+// Corrupted 返回最近一次巡检结果为损坏的归档，键为归档文件名
+func Corrupted(checks []Check) map[string]Check {
+	latest := map[string]Check{}
+	for _, c := range checks {
+		if c.Status != CheckError {
+			latest[c.Archive] = c
+		}
+	}
+
+	corrupted := map[string]Check{}
+	for name, c := range latest {
+		if c.Status == CheckCorrupt {
+			corrupted[name] = c
+		}
+	}
+	return corrupted
+}
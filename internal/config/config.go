@@ -1,76 +1,388 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+	"github.com/xg4/vaultwarden-backup/pkg/pattern"
+	"github.com/xg4/vaultwarden-backup/pkg/sign"
+	"github.com/xg4/vaultwarden-backup/pkg/targz"
+	"gopkg.in/yaml.v3"
 )
 
-// Config 保存了应用的所有配置
+// Config 保存了单个备份任务的所有配置
 type Config struct {
+	Name              string // 任务名称，单任务模式下与 BackupName 相同
 	BackupDir         string
 	TmpDir            string
 	DataDir           string
 	BackupName        string
 	PruneBackupsDays  int
 	PruneBackupsCount int
-	Password          string
+	Password          secret.Value
+	DatabaseURL       secret.Value // Vaultwarden 的 DATABASE_URL，为空时使用 DataDir 中的 SQLite
+	Include           []string     // 备份包含的路径规则（gitignore 风格），为空时使用内置列表
+	Exclude           []string     // 备份排除的路径规则（gitignore 风格）
 	BackupInterval    time.Duration
+	HealthMaxAge      time.Duration     // 最近一次成功备份超过该时长时视为未就绪
+	PingStartURL      secret.Value      // 备份开始时请求的监控地址（healthchecks.io、Uptime Kuma 推送等）
+	PingSuccessURL    secret.Value      // 备份成功时请求的监控地址
+	PingFailURL       secret.Value      // 备份失败时请求的监控地址，请求体为失败原因
+	ScrubInterval     time.Duration     // 定期重新校验已有归档的间隔，0 表示不巡检
+	ScrubRateLimit    int               // 巡检读取归档的速度上限（MB/s），0 表示不限速
+	ParityPercent     int               // 纠错数据占归档大小的百分比，0 表示不生成
+	SigningKeyFile    string            // 签名归档的 Ed25519 私钥文件，为空时不签名
+	Compression       targz.Compression // 归档的压缩算法和级别
 }
 
-// Load 从环境变量中加载配置
-func Load() (*Config, error) {
-	password := os.Getenv("PASSWORD")
-	if strings.TrimSpace(password) == "" {
-		return nil, fmt.Errorf("错误：未设置 PASSWORD 环境变量。请设置备份密码：export PASSWORD='your_password'")
+// Settings 整个备份进程的配置
+type Settings struct {
+	MaxConcurrentJobs int       // 同时运行的备份任务上限
+	Jobs              []*Config // 备份任务，未配置 jobs 时只有一个
+	ControlSocket     string    // 控制 socket 路径，为空时不启用
+	ListenAddr        string    // HTTP 监听地址（/metrics 等），为空时不启用
+	Notify            []Notify  // 通知目标
+
+	multi bool // 任务来自配置文件中的 jobs 列表
+}
+
+// jobNamePattern 任务名称会用于临时目录名，只允许安全字符
+var jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Load 加载配置：默认值 < CONFIG_FILE 指定的配置文件 < 环境变量 < 配置文件中各任务自身的设置
+func Load() (*Settings, error) {
+	file := defaultFile()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := readFile(path, &file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(&file); err != nil {
+		return nil, err
+	}
+
+	maxConcurrentJobsStr := getEnv("MAX_CONCURRENT_JOBS", strconv.Itoa(int(file.MaxConcurrentJobs)))
+	maxConcurrentJobs, err := strconv.Atoi(maxConcurrentJobsStr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 MAX_CONCURRENT_JOBS: %v", err)
+	}
+	if maxConcurrentJobs < 1 {
+		maxConcurrentJobs = 1
+	}
+	settings := &Settings{
+		MaxConcurrentJobs: maxConcurrentJobs,
+		ControlSocket:     getEnv("CONTROL_SOCKET", file.ControlSocket),
+		ListenAddr:        getEnv("LISTEN_ADDR", file.ListenAddr),
+		Notify:            file.Notify,
+		multi:             len(file.Jobs) > 0,
+	}
+
+	notify, err := envNotify()
+	if err != nil {
+		return nil, err
+	}
+	if notify != nil {
+		settings.Notify = append(settings.Notify, *notify)
+	}
+
+	// 未配置 jobs 时保持单任务模式，临时目录名称与以前一致
+	if len(file.Jobs) == 0 {
+		if file.Password.IsZero() {
+			return nil, fmt.Errorf("错误：未设置 PASSWORD 环境变量。请设置备份密码：export PASSWORD='your_password' 或 PASSWORD_FILE=/run/secrets/password")
+		}
+		if err := file.check(); err != nil {
+			return nil, err
+		}
+		cfg := file.config(file.BackupName, "")
+		settings.Jobs = []*Config{cfg}
+		return settings, nil
 	}
 
-	pruneBackupsDaysStr := getEnv("PRUNE_BACKUPS_DAYS", "30")
+	names := map[string]bool{}
+	archives := map[string]string{}
+	for _, job := range file.Jobs {
+		if !jobNamePattern.MatchString(job.Name) {
+			return nil, fmt.Errorf("line %d: 无效的任务名称 %q，只能包含字母、数字、点、下划线和连字符", job.line, job.Name)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("line %d: 任务名称 %s 重复", job.line, job.Name)
+		}
+		names[job.Name] = true
+
+		fc, err := job.apply(file)
+		if err != nil {
+			return nil, fmt.Errorf("任务 %s: %w", job.Name, err)
+		}
+		if fc.Password.IsZero() {
+			return nil, fmt.Errorf("任务 %s: 未设置密码，请在任务或顶层配置 password/password_file，或设置 PASSWORD 环境变量", job.Name)
+		}
+		if err := fc.check(); err != nil {
+			return nil, fmt.Errorf("任务 %s: %w", job.Name, err)
+		}
+
+		// 同一备份目录下的归档名称必须不同，否则清理时会删除其他任务的备份
+		key := filepath.Join(fc.BackupDir, fc.BackupName)
+		if other, ok := archives[key]; ok {
+			return nil, fmt.Errorf("任务 %s 与 %s 使用了相同的备份目录和 backup_name: %s", job.Name, other, key)
+		}
+		archives[key] = job.Name
+
+		settings.Jobs = append(settings.Jobs, fc.config(job.Name, "_"+job.Name))
+	}
+
+	return settings, nil
+}
+
+// check 检查无法在解析时校验的取值
+func (fc fileConfig) check() error {
+	if fc.ParityPercent > 100 {
+		return fmt.Errorf("无效的 parity_percent: %d，应在 0 到 100 之间", fc.ParityPercent)
+	}
+	if _, err := targz.ParseCompression(fc.Compression); err != nil {
+		return fmt.Errorf("无效的 compression: %v", err)
+	}
+	if fc.SigningKeyFile != "" {
+		if _, err := sign.LoadPrivateKey(fc.SigningKeyFile); err != nil {
+			return fmt.Errorf("无效的 signing_key_file: %v", err)
+		}
+	}
+	return fc.checkPingURLs()
+}
+
+// checkPingURLs 检查监控地址是否为 http(s) 地址，错误信息中不包含地址本身
+func (fc fileConfig) checkPingURLs() error {
+	for _, ping := range []struct {
+		key   string
+		value secret.Value
+	}{
+		{"ping_start_url", fc.PingStartURL},
+		{"ping_success_url", fc.PingSuccessURL},
+		{"ping_fail_url", fc.PingFailURL},
+	} {
+		if ping.value.IsZero() {
+			continue
+		}
+		u, err := url.Parse(ping.value.Reveal())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("无效的 %s，应为 http(s) 地址", ping.key)
+		}
+	}
+	return nil
+}
+
+// config 将合并后的配置转换为任务配置，suffix 用于区分各任务的临时目录
+func (fc fileConfig) config(name, suffix string) *Config {
+	// 默认允许错过一次定时备份
+	maxAge := time.Duration(fc.HealthMaxAge)
+	if maxAge == 0 {
+		maxAge = 2 * time.Duration(fc.BackupInterval)
+	}
+
+	// 取值已由 check 校验
+	compression, _ := targz.ParseCompression(fc.Compression)
+
+	return &Config{
+		Name:              name,
+		BackupDir:         fc.BackupDir,
+		TmpDir:            filepath.Join(fc.BackupDir, ".backup_tmp"+suffix),
+		DataDir:           fc.DataDir,
+		BackupName:        fc.BackupName,
+		PruneBackupsDays:  int(fc.PruneBackupsDays),
+		PruneBackupsCount: int(fc.PruneBackupsCount),
+		Password:          fc.Password,
+		DatabaseURL:       fc.DatabaseURL,
+		Include:           fc.Include,
+		Exclude:           fc.Exclude,
+		BackupInterval:    time.Duration(fc.BackupInterval),
+		HealthMaxAge:      maxAge,
+		PingStartURL:      fc.PingStartURL,
+		PingSuccessURL:    fc.PingSuccessURL,
+		PingFailURL:       fc.PingFailURL,
+		ScrubInterval:     time.Duration(fc.ScrubInterval),
+		ScrubRateLimit:    int(fc.ScrubRateLimit),
+		ParityPercent:     int(fc.ParityPercent),
+		SigningKeyFile:    fc.SigningKeyFile,
+		Compression:       compression,
+	}
+}
+
+// applyEnv 用环境变量覆盖顶层配置
+func applyEnv(file *fileConfig) error {
+	password, err := getSecretEnv("PASSWORD")
+	if err == nil {
+		file.Password = password
+	} else if !errors.Is(err, secret.ErrNotProvided) {
+		return err
+	}
+
+	pruneBackupsDaysStr := getEnv("PRUNE_BACKUPS_DAYS", strconv.Itoa(int(file.PruneBackupsDays)))
 	pruneBackupsDays, err := strconv.Atoi(pruneBackupsDaysStr)
 	if err != nil {
-		return nil, fmt.Errorf("无效的 PRUNE_BACKUPS_DAYS: %v", err)
+		return fmt.Errorf("无效的 PRUNE_BACKUPS_DAYS: %v", err)
 	}
 	if pruneBackupsDays < 0 {
 		pruneBackupsDays = 0
 	}
 
-	pruneBackupsCountStr := getEnv("PRUNE_BACKUPS_COUNT", "0")
+	pruneBackupsCountStr := getEnv("PRUNE_BACKUPS_COUNT", strconv.Itoa(int(file.PruneBackupsCount)))
 	pruneBackupsCount, err := strconv.Atoi(pruneBackupsCountStr)
 	if err != nil {
-		return nil, fmt.Errorf("无效的 PRUNE_BACKUPS_COUNT: %v", err)
+		return fmt.Errorf("无效的 PRUNE_BACKUPS_COUNT: %v", err)
 	}
 	if pruneBackupsCount < 0 {
 		pruneBackupsCount = 0
 	}
 
-	backupIntervalStr := getEnv("BACKUP_INTERVAL", "6h")
+	backupIntervalStr := getEnv("BACKUP_INTERVAL", time.Duration(file.BackupInterval).String())
 	backupInterval, err := time.ParseDuration(backupIntervalStr)
 	if err != nil {
-		return nil, fmt.Errorf("无效的 BACKUP_INTERVAL: %v", err)
+		return fmt.Errorf("无效的 BACKUP_INTERVAL: %v", err)
 	}
 	if backupInterval < time.Minute {
 		backupInterval = time.Minute
 	}
 
-	backupDir := getEnv("BACKUP_DIR", "/backups")
-	dataDir := getEnv("DATA_DIR", "/data")
-	tmpDir := filepath.Join(backupDir, "/.backup_tmp")
+	if value, ok := os.LookupEnv("HEALTH_MAX_AGE"); ok {
+		healthMaxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("无效的 HEALTH_MAX_AGE: %v", err)
+		}
+		file.HealthMaxAge = duration(healthMaxAge)
+	}
+
+	// SCRUB_INTERVAL 为空或 0 时不巡检
+	if value, ok := os.LookupEnv("SCRUB_INTERVAL"); ok {
+		scrubInterval := time.Duration(0)
+		if value != "" && value != "0" {
+			if scrubInterval, err = time.ParseDuration(value); err != nil {
+				return fmt.Errorf("无效的 SCRUB_INTERVAL: %v", err)
+			}
+			if scrubInterval < time.Minute {
+				scrubInterval = time.Minute
+			}
+		}
+		file.ScrubInterval = duration(scrubInterval)
+	}
+
+	scrubRateLimit, err := strconv.Atoi(getEnv("SCRUB_RATE_LIMIT", strconv.Itoa(int(file.ScrubRateLimit))))
+	if err != nil {
+		return fmt.Errorf("无效的 SCRUB_RATE_LIMIT: %v", err)
+	}
+	if scrubRateLimit < 0 {
+		scrubRateLimit = 0
+	}
+	file.ScrubRateLimit = count(scrubRateLimit)
+
+	parityPercent, err := strconv.Atoi(getEnv("PARITY_PERCENT", strconv.Itoa(int(file.ParityPercent))))
+	if err != nil {
+		return fmt.Errorf("无效的 PARITY_PERCENT: %v", err)
+	}
+	if parityPercent < 0 {
+		parityPercent = 0
+	}
+	file.ParityPercent = count(parityPercent)
+	file.SigningKeyFile = getEnv("SIGNING_KEY_FILE", file.SigningKeyFile)
+	file.Compression = getEnv("COMPRESSION", file.Compression)
+
+	databaseURL, err := getSecretEnv("DATABASE_URL")
+	if err == nil {
+		file.DatabaseURL = databaseURL
+	} else if !errors.Is(err, secret.ErrNotProvided) {
+		return err
+	}
+
+	for key, dst := range map[string]*secret.Value{
+		"PING_START_URL":   &file.PingStartURL,
+		"PING_SUCCESS_URL": &file.PingSuccessURL,
+		"PING_FAIL_URL":    &file.PingFailURL,
+	} {
+		value, err := getSecretEnv(key)
+		if err == nil {
+			*dst = value
+		} else if !errors.Is(err, secret.ErrNotProvided) {
+			return err
+		}
+	}
+
+	include := getListEnv("INCLUDE", file.Include)
+	if _, err := pattern.New(include); err != nil {
+		return fmt.Errorf("无效的 INCLUDE: %v", err)
+	}
+	exclude := getListEnv("EXCLUDE", file.Exclude)
+	if _, err := pattern.New(exclude); err != nil {
+		return fmt.Errorf("无效的 EXCLUDE: %v", err)
+	}
+
+	file.BackupDir = getEnv("BACKUP_DIR", file.BackupDir)
+	file.DataDir = getEnv("DATA_DIR", file.DataDir)
+	file.BackupName = getEnv("BACKUP_NAME", file.BackupName)
+	file.PruneBackupsDays = count(pruneBackupsDays)
+	file.PruneBackupsCount = count(pruneBackupsCount)
+	file.BackupInterval = duration(backupInterval)
+	file.Include = include
+	file.Exclude = exclude
+	return nil
+}
+
+// Redacted 以配置文件格式（YAML）输出生效的配置，敏感值已脱敏
+func (s *Settings) Redacted() ([]byte, error) {
+	if !s.multi {
+		fc := s.Jobs[0].file()
+		fc.ControlSocket = s.ControlSocket
+		fc.ListenAddr = s.ListenAddr
+		fc.Notify = s.Notify
+		return yaml.Marshal(fc)
+	}
 
-	cfg := &Config{
-		BackupDir:         backupDir,
-		DataDir:           dataDir,
-		TmpDir:            tmpDir,
-		BackupName:        getEnv("BACKUP_NAME", "vault"),
-		PruneBackupsDays:  pruneBackupsDays,
-		PruneBackupsCount: pruneBackupsCount,
-		Password:          password,
-		BackupInterval:    backupInterval,
+	type job struct {
+		Name       string `yaml:"name"`
+		fileConfig `yaml:",inline"`
 	}
+	out := struct {
+		MaxConcurrentJobs int      `yaml:"max_concurrent_jobs"`
+		ControlSocket     string   `yaml:"control_socket,omitempty"`
+		ListenAddr        string   `yaml:"listen_addr,omitempty"`
+		Notify            []Notify `yaml:"notify,omitempty"`
+		Jobs              []job    `yaml:"jobs"`
+	}{MaxConcurrentJobs: s.MaxConcurrentJobs, ControlSocket: s.ControlSocket, ListenAddr: s.ListenAddr, Notify: s.Notify}
+	for _, cfg := range s.Jobs {
+		out.Jobs = append(out.Jobs, job{Name: cfg.Name, fileConfig: cfg.file()})
+	}
+	return yaml.Marshal(out)
+}
 
-	return cfg, nil
+// file 将任务配置转换回配置文件格式
+func (c *Config) file() fileConfig {
+	return fileConfig{
+		BackupDir:         c.BackupDir,
+		DataDir:           c.DataDir,
+		BackupName:        c.BackupName,
+		Password:          c.Password,
+		DatabaseURL:       c.DatabaseURL,
+		BackupInterval:    duration(c.BackupInterval),
+		HealthMaxAge:      duration(c.HealthMaxAge),
+		PingStartURL:      c.PingStartURL,
+		PingSuccessURL:    c.PingSuccessURL,
+		PingFailURL:       c.PingFailURL,
+		PruneBackupsDays:  count(c.PruneBackupsDays),
+		PruneBackupsCount: count(c.PruneBackupsCount),
+		ScrubInterval:     duration(c.ScrubInterval),
+		ScrubRateLimit:    count(c.ScrubRateLimit),
+		ParityPercent:     count(c.ParityPercent),
+		SigningKeyFile:    c.SigningKeyFile,
+		Compression:       c.Compression.String(),
+		Include:           c.Include,
+		Exclude:           c.Exclude,
+	}
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -80,3 +392,33 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getListEnv 获取以逗号或换行分隔的列表环境变量，如果不存在则返回默认值
+func getListEnv(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getSecretEnv 读取敏感配置，支持 Docker secrets 约定的 KEY_FILE 变量
+func getSecretEnv(key string) (secret.Value, error) {
+	file := os.Getenv(key + "_FILE")
+	if file != "" && os.Getenv(key) != "" {
+		return "", fmt.Errorf("%s 与 %s_FILE 不能同时设置", key, key)
+	}
+
+	value, err := secret.Resolve(secret.Sources{File: file, Env: key})
+	if err != nil {
+		return "", err
+	}
+	return secret.Value(value), nil
+}
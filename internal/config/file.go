@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+	"github.com/xg4/vaultwarden-backup/pkg/pattern"
+	"github.com/xg4/vaultwarden-backup/pkg/targz"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig 配置文件（YAML）的结构，未知的键会被拒绝
+type fileConfig struct {
+	BackupDir         string       `yaml:"backup_dir"`
+	DataDir           string       `yaml:"data_dir"`
+	BackupName        string       `yaml:"backup_name"`
+	Password          secret.Value `yaml:"password,omitempty"`
+	PasswordFile      string       `yaml:"password_file,omitempty"`
+	DatabaseURL       secret.Value `yaml:"database_url,omitempty"`
+	DatabaseURLFile   string       `yaml:"database_url_file,omitempty"`
+	BackupInterval    duration     `yaml:"backup_interval"`
+	HealthMaxAge      duration     `yaml:"health_max_age,omitempty"`
+	PingStartURL      secret.Value `yaml:"ping_start_url,omitempty"`
+	PingSuccessURL    secret.Value `yaml:"ping_success_url,omitempty"`
+	PingFailURL       secret.Value `yaml:"ping_fail_url,omitempty"`
+	PruneBackupsDays  count        `yaml:"prune_backups_days"`
+	PruneBackupsCount count        `yaml:"prune_backups_count"`
+	ScrubInterval     duration     `yaml:"scrub_interval,omitempty"`
+	ScrubRateLimit    count        `yaml:"scrub_rate_limit"`
+	ParityPercent     count        `yaml:"parity_percent,omitempty"`
+	SigningKeyFile    string       `yaml:"signing_key_file,omitempty"`
+	Compression       string       `yaml:"compression"`
+	Include           patterns     `yaml:"include,omitempty"`
+	Exclude           patterns     `yaml:"exclude,omitempty"`
+	MaxConcurrentJobs count        `yaml:"max_concurrent_jobs,omitempty"`
+	ControlSocket     string       `yaml:"control_socket,omitempty"`
+	ListenAddr        string       `yaml:"listen_addr,omitempty"`
+	Notify            []Notify     `yaml:"notify,omitempty"`
+	Jobs              []jobConfig  `yaml:"jobs,omitempty"`
+}
+
+// jobConfig 配置文件中的单个备份任务，未设置的键继承顶层配置
+type jobConfig struct {
+	Name              string        `yaml:"name"`
+	BackupDir         *string       `yaml:"backup_dir"`
+	DataDir           *string       `yaml:"data_dir"`
+	BackupName        *string       `yaml:"backup_name"`
+	Password          *secret.Value `yaml:"password"`
+	PasswordFile      *string       `yaml:"password_file"`
+	DatabaseURL       *secret.Value `yaml:"database_url"`
+	DatabaseURLFile   *string       `yaml:"database_url_file"`
+	BackupInterval    *duration     `yaml:"backup_interval"`
+	HealthMaxAge      *duration     `yaml:"health_max_age"`
+	PingStartURL      *secret.Value `yaml:"ping_start_url"`
+	PingSuccessURL    *secret.Value `yaml:"ping_success_url"`
+	PingFailURL       *secret.Value `yaml:"ping_fail_url"`
+	PruneBackupsDays  *count        `yaml:"prune_backups_days"`
+	PruneBackupsCount *count        `yaml:"prune_backups_count"`
+	ScrubInterval     *duration     `yaml:"scrub_interval"`
+	ScrubRateLimit    *count        `yaml:"scrub_rate_limit"`
+	ParityPercent     *count        `yaml:"parity_percent"`
+	SigningKeyFile    *string       `yaml:"signing_key_file"`
+	Compression       *string       `yaml:"compression"`
+	Include           *patterns     `yaml:"include"`
+	Exclude           *patterns     `yaml:"exclude"`
+
+	line int // 任务在配置文件中的行号，用于错误信息
+}
+
+// jobKeys 任务中允许的键；Node.Decode 不继承 KnownFields，需要自行检查
+var jobKeys = yamlKeys(jobConfig{})
+
+func (j *jobConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: 任务应为映射", node.Line)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if key := node.Content[i]; !jobKeys[key.Value] {
+			return fmt.Errorf("line %d: 未知的键 %s", key.Line, key.Value)
+		}
+	}
+
+	type plain jobConfig
+	if err := node.Decode((*plain)(j)); err != nil {
+		return err
+	}
+	j.line = node.Line
+	return nil
+}
+
+// defaultFile 返回填充了默认值的配置，配置文件和环境变量在此基础上覆盖
+func defaultFile() fileConfig {
+	return fileConfig{
+		BackupDir:         "/backups",
+		DataDir:           "/data",
+		BackupName:        "vault",
+		BackupInterval:    duration(6 * time.Hour),
+		PruneBackupsDays:  30,
+		PruneBackupsCount: 0,
+		ScrubRateLimit:    20,
+		Compression:       targz.DefaultCompression.String(),
+		MaxConcurrentJobs: 2,
+	}
+}
+
+// apply 在顶层配置的基础上应用任务自身的设置
+func (j jobConfig) apply(top fileConfig) (fileConfig, error) {
+	fc := top
+	fc.Jobs = nil
+	fc.Notify = nil
+	fc.BackupName = j.Name
+
+	setString(&fc.BackupDir, j.BackupDir)
+	setString(&fc.DataDir, j.DataDir)
+	setString(&fc.BackupName, j.BackupName)
+	setString(&fc.SigningKeyFile, j.SigningKeyFile)
+	setString(&fc.Compression, j.Compression)
+	if j.BackupInterval != nil {
+		fc.BackupInterval = *j.BackupInterval
+	}
+	if j.HealthMaxAge != nil {
+		fc.HealthMaxAge = *j.HealthMaxAge
+	}
+	if j.PruneBackupsDays != nil {
+		fc.PruneBackupsDays = *j.PruneBackupsDays
+	}
+	if j.PruneBackupsCount != nil {
+		fc.PruneBackupsCount = *j.PruneBackupsCount
+	}
+	if j.ScrubInterval != nil {
+		fc.ScrubInterval = *j.ScrubInterval
+	}
+	if j.ScrubRateLimit != nil {
+		fc.ScrubRateLimit = *j.ScrubRateLimit
+	}
+	if j.ParityPercent != nil {
+		fc.ParityPercent = *j.ParityPercent
+	}
+	if j.Include != nil {
+		fc.Include = *j.Include
+	}
+	if j.Exclude != nil {
+		fc.Exclude = *j.Exclude
+	}
+	for _, ping := range []struct{ dst, value *secret.Value }{
+		{&fc.PingStartURL, j.PingStartURL},
+		{&fc.PingSuccessURL, j.PingSuccessURL},
+		{&fc.PingFailURL, j.PingFailURL},
+	} {
+		if ping.value != nil {
+			*ping.dst = *ping.value
+		}
+	}
+
+	if err := j.secret(&fc.Password, j.Password, j.PasswordFile, "password"); err != nil {
+		return fc, err
+	}
+	if err := j.secret(&fc.DatabaseURL, j.DatabaseURL, j.DatabaseURLFile, "database_url"); err != nil {
+		return fc, err
+	}
+	return fc, nil
+}
+
+// secret 任务中设置了 key 或 key_file 时覆盖继承的敏感值
+func (j jobConfig) secret(dst *secret.Value, value *secret.Value, file *string, key string) error {
+	if value == nil && file == nil {
+		return nil
+	}
+
+	var v secret.Value
+	if value != nil {
+		v = *value
+	}
+	var f string
+	if file != nil {
+		f = *file
+	}
+	if err := resolveFileSecret(&v, f, key); err != nil {
+		return fmt.Errorf("line %d: %w", j.line, err)
+	}
+	*dst = v
+	return nil
+}
+
+// yamlKeys 返回结构体的 yaml 键名
+func yamlKeys(v any) map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); name != "" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+func setString(dst *string, value *string) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+// readFile 读取并严格校验配置文件，错误信息包含行号
+func readFile(path string, fc *fileConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(fc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("配置文件 %s 无效: %w", path, err)
+	}
+
+	if err := resolveFileSecret(&fc.Password, fc.PasswordFile, "password"); err != nil {
+		return fmt.Errorf("配置文件 %s 无效: %w", path, err)
+	}
+	if err := resolveFileSecret(&fc.DatabaseURL, fc.DatabaseURLFile, "database_url"); err != nil {
+		return fmt.Errorf("配置文件 %s 无效: %w", path, err)
+	}
+	for i := range fc.Notify {
+		if err := fc.Notify[i].resolve(); err != nil {
+			return fmt.Errorf("配置文件 %s 无效: notify[%d]: %w", path, i, err)
+		}
+	}
+	return nil
+}
+
+// resolveFileSecret 处理配置文件中的 xxx_file 键
+func resolveFileSecret(value *secret.Value, file, key string) error {
+	if file == "" {
+		return nil
+	}
+	if !value.IsZero() {
+		return fmt.Errorf("%s 与 %s_file 不能同时设置", key, key)
+	}
+
+	v, err := secret.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("%s_file: %w", key, err)
+	}
+	*value = secret.Value(v)
+	return nil
+}
+
+// duration 配置文件中的时长，如 6h、30m，不小于 1 分钟
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: 无效的时长 %q", node.Line, node.Value)
+	}
+	if v < time.Minute {
+		return fmt.Errorf("line %d: 时长 %q 不能小于 1m", node.Line, node.Value)
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// count 配置文件中的非负整数
+type count int
+
+func (c *count) UnmarshalYAML(node *yaml.Node) error {
+	var v int
+	if err := node.Decode(&v); err != nil {
+		return fmt.Errorf("line %d: 无效的整数 %q", node.Line, node.Value)
+	}
+	if v < 0 {
+		return fmt.Errorf("line %d: %d 不能为负数", node.Line, v)
+	}
+	*c = count(v)
+	return nil
+}
+
+// patterns 配置文件中的 gitignore 风格路径规则列表
+type patterns []string
+
+func (p *patterns) UnmarshalYAML(node *yaml.Node) error {
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return fmt.Errorf("line %d: 应为字符串列表", node.Line)
+	}
+	for i, item := range list {
+		if _, err := pattern.New([]string{item}); err != nil {
+			return fmt.Errorf("line %d: %v", node.Content[i].Line, err)
+		}
+	}
+	*p = list
+	return nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+)
+
+// Notify 通知目标的配置，配置文件中通过 notify 列表设置，环境变量 NOTIFY_* 可额外提供一个
+type Notify struct {
+	Type      string       `yaml:"type"`                 // webhook、discord、slack、telegram、gotify、ntfy、email
+	URL       secret.Value `yaml:"url,omitempty"`        // Webhook 地址或服务地址，通常包含令牌
+	URLFile   string       `yaml:"url_file,omitempty"`   // 从文件读取 url
+	Token     secret.Value `yaml:"token,omitempty"`      // Telegram 机器人令牌、Gotify 应用令牌或 ntfy 访问令牌
+	TokenFile string       `yaml:"token_file,omitempty"` // 从文件读取 token
+	ChatID    string       `yaml:"chat_id,omitempty"`    // Telegram 聊天 ID
+	On        string       `yaml:"on,omitempty"`         // failure（默认）、always、recovery、never
+	Template  string       `yaml:"template,omitempty"`   // text/template 消息模板，为空时使用内置模板
+
+	// 以下仅用于 email
+	Host         string       `yaml:"host,omitempty"`          // SMTP 服务器
+	Port         int          `yaml:"port,omitempty"`          // 默认按 tls 取 587、465 或 25
+	TLS          string       `yaml:"tls,omitempty"`           // starttls（默认）、tls（隐式 TLS）、none
+	Username     string       `yaml:"username,omitempty"`      // 为空时不认证
+	Password     secret.Value `yaml:"password,omitempty"`      // SMTP 密码
+	PasswordFile string       `yaml:"password_file,omitempty"` // 从文件读取 password
+	From         string       `yaml:"from,omitempty"`          // 发件人
+	To           []string     `yaml:"to,omitempty"`            // 收件人
+	Digest       string       `yaml:"digest,omitempty"`        // weekly 时每周发送一次汇总
+}
+
+// notifyOn NOTIFY_ON 的可选值
+var notifyOn = map[string]bool{"": true, "failure": true, "always": true, "recovery": true, "never": true}
+
+// resolve 读取 *_file 并检查 on 的取值
+func (n *Notify) resolve() error {
+	if err := resolveFileSecret(&n.URL, n.URLFile, "url"); err != nil {
+		return err
+	}
+	if err := resolveFileSecret(&n.Token, n.TokenFile, "token"); err != nil {
+		return err
+	}
+	if err := resolveFileSecret(&n.Password, n.PasswordFile, "password"); err != nil {
+		return err
+	}
+	n.URLFile, n.TokenFile, n.PasswordFile = "", "", ""
+
+	if n.Type == "" {
+		return fmt.Errorf("未设置 type")
+	}
+	if !notifyOn[n.On] {
+		return fmt.Errorf("无效的 on: %s，可选 failure、always、recovery、never", n.On)
+	}
+	return nil
+}
+
+// envNotify 从 NOTIFY_* 环境变量读取通知目标，未设置 NOTIFY_TYPE 和 NOTIFY_URL 时返回 nil
+func envNotify() (*Notify, error) {
+	url, err := getSecretEnv("NOTIFY_URL")
+	if err != nil && !errors.Is(err, secret.ErrNotProvided) {
+		return nil, err
+	}
+	token, err := getSecretEnv("NOTIFY_TOKEN")
+	if err != nil && !errors.Is(err, secret.ErrNotProvided) {
+		return nil, err
+	}
+
+	password, err := getSecretEnv("SMTP_PASSWORD")
+	if err != nil && !errors.Is(err, secret.ErrNotProvided) {
+		return nil, err
+	}
+
+	typ := os.Getenv("NOTIFY_TYPE")
+	if typ == "" && url.IsZero() {
+		return nil, nil
+	}
+	if typ == "" {
+		typ = "webhook"
+	}
+
+	var port int
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		if port, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("无效的 SMTP_PORT: %v", err)
+		}
+	}
+
+	n := &Notify{
+		Type:     typ,
+		URL:      url,
+		Token:    token,
+		ChatID:   os.Getenv("NOTIFY_CHAT_ID"),
+		On:       os.Getenv("NOTIFY_ON"),
+		Template: os.Getenv("NOTIFY_TEMPLATE"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		TLS:      os.Getenv("SMTP_TLS"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: password,
+		From:     os.Getenv("SMTP_FROM"),
+		To:       getListEnv("SMTP_TO", nil),
+		Digest:   os.Getenv("NOTIFY_DIGEST"),
+	}
+	if err := n.resolve(); err != nil {
+		return nil, fmt.Errorf("NOTIFY_*: %w", err)
+	}
+	return n, nil
+}
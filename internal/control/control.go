@@ -0,0 +1,128 @@
+package control
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Handler 处理一条控制命令，返回给客户端的说明
+type Handler func(cmd string) (string, error)
+
+// Server 基于 Unix socket 的控制接口，每个连接发送一行命令并收到一行响应：
+// "ok <说明>" 或 "error <错误>"
+type Server struct {
+	path     string
+	listener net.Listener
+	handler  Handler
+}
+
+// Listen 在 path 上创建控制 socket，只允许当前用户访问
+func Listen(path string, handler Handler) (*Server, error) {
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("创建控制 socket 失败: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("设置控制 socket 权限失败: %w", err)
+	}
+
+	s := &Server{path: path, listener: listener, handler: handler}
+	go s.serve()
+	return s, nil
+}
+
+// Close 停止监听并删除 socket 文件
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Warn("⚠️ 控制连接失败", "error", err)
+			continue
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle 处理单个连接；命令会同步执行，重新加载等操作完成后才响应
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	cmd := strings.TrimSpace(line)
+	slog.Debug("🎛️ 收到控制命令", "command", cmd)
+
+	msg, err := s.handler(cmd)
+	if err != nil {
+		fmt.Fprintf(conn, "error %s\n", oneLine(err.Error()))
+		return
+	}
+	fmt.Fprintf(conn, "ok %s\n", oneLine(msg))
+}
+
+// Send 向控制 socket 发送命令并返回响应说明
+func Send(path, cmd string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("连接控制 socket 失败: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return "", fmt.Errorf("发送控制命令失败: %w", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取控制响应失败: %w", err)
+	}
+
+	status, msg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if status != "ok" {
+		return "", errors.New(msg)
+	}
+	return msg, nil
+}
+
+// removeStale 删除上次异常退出遗留的 socket 文件，若仍有进程在监听则报错
+func removeStale(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("控制 socket 已被其他进程使用: %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("删除旧的控制 socket 失败: %w", err)
+	}
+	return nil
+}
+
+// oneLine 将多行错误信息合并为一行
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,422 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/app"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/scrub"
+)
+
+// Daemon 备份服务，按各自的间隔定时执行多个备份任务，支持运行中替换配置
+type Daemon struct {
+	mu   sync.Mutex
+	ctx  context.Context
+	sem  *limiter        // 限制同时运行的备份数量
+	jobs map[string]*job // 按任务名称索引
+
+	loops sync.WaitGroup // 各任务的定时循环
+	runs  sync.WaitGroup // 正在进行的备份
+
+	observers      []Observer      // 每次备份结束后调用
+	scrubObservers []ScrubObserver // 每次巡检结束后调用
+}
+
+// Observer 接收每次备份的运行报告，如指标统计和通知
+type Observer func(cfg *config.Config, rep *report.Report)
+
+// ScrubObserver 接收每次巡检的结果
+type ScrubObserver func(cfg *config.Config, rep *scrub.Report)
+
+// job 单个备份任务的运行状态
+type job struct {
+	cfg      atomic.Pointer[config.Config] // 当前配置，每次备份开始时读取
+	interval chan time.Duration            // 重新加载后的新备份间隔
+	probe    chan chan struct{}            // 健康检查，确认定时循环仍在响应
+	cancel   context.CancelFunc            // 停止定时循环，不影响正在进行的备份
+	running  atomic.Bool                   // 上一次备份是否仍在进行（包括排队等待）
+
+	scrubInterval chan time.Duration // 重新加载后的新巡检间隔
+	scrubbing     atomic.Bool        // 上一次巡检是否仍在进行
+	archives      sync.Mutex         // 备份与巡检互斥，归档在写入或清理时不会被巡检
+	observing     sync.Mutex         // 按备份完成的顺序调用观察者，恢复通知依赖上一次的结果
+
+	mu          sync.Mutex
+	next        time.Time // 下一次定时备份的时间
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	lastScrub   time.Time
+}
+
+// JobStatus 备份任务的状态，用于 /status 和就绪检查
+type JobStatus struct {
+	Name        string     `json:"name"`
+	BackupName  string     `json:"backup_name"`
+	Interval    string     `json:"interval"` // 如 6h0m0s
+	MaxAge      string     `json:"max_age"`
+	Running     bool       `json:"running"`
+	Ready       bool       `json:"ready"`                  // 最近一次成功备份在 MaxAge 以内
+	LastRun     *time.Time `json:"last_run,omitempty"`     // 最近一次运行结束的时间
+	LastSuccess *time.Time `json:"last_success,omitempty"` // 最近一次成功的时间
+	LastError   string     `json:"last_error,omitempty"`   // 最近一次运行的错误，成功后清空
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastScrub   *time.Time `json:"last_scrub,omitempty"` // 最近一次巡检结束的时间
+}
+
+// New 创建备份服务实例
+func New(settings *config.Settings) *Daemon {
+	d := &Daemon{
+		sem:  newLimiter(settings.MaxConcurrentJobs),
+		jobs: map[string]*job{},
+	}
+	for _, cfg := range settings.Jobs {
+		d.jobs[cfg.Name] = newJob(cfg)
+	}
+	return d
+}
+
+func newJob(cfg *config.Config) *job {
+	j := &job{
+		interval:      make(chan time.Duration, 1),
+		scrubInterval: make(chan time.Duration, 1),
+		probe:         make(chan chan struct{}),
+	}
+	j.cfg.Store(cfg)
+	return j
+}
+
+// OnRun 注册备份结束后的回调，需在 Start 之前调用
+func (d *Daemon) OnRun(o Observer) {
+	d.observers = append(d.observers, o)
+}
+
+// OnScrub 注册巡检结束后的回调，需在 Start 之前调用
+func (d *Daemon) OnScrub(o ScrubObserver) {
+	d.scrubObservers = append(d.scrubObservers, o)
+}
+
+// Start 为每个任务执行初始备份并启动定时备份，ctx 取消后停止调度
+func (d *Daemon) Start(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ctx = ctx
+	for _, j := range d.jobs {
+		d.start(j, true)
+	}
+}
+
+// Reload 替换配置：更新现有任务的配置和间隔，启动新增的任务，停止已删除的任务。
+// 正在进行的备份继续使用开始时的配置，不会被中断
+func (d *Daemon) Reload(settings *config.Settings) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 正在进行的备份继续占用名额，调低上限后要等它们完成才会开始新的备份
+	d.sem.setLimit(settings.MaxConcurrentJobs)
+
+	next := make(map[string]*job, len(settings.Jobs))
+	for _, cfg := range settings.Jobs {
+		j, ok := d.jobs[cfg.Name]
+		if !ok {
+			j = newJob(cfg)
+			slog.Info("➕ 新增备份任务", "job", cfg.Name)
+			if d.ctx != nil {
+				d.start(j, true)
+			}
+			next[cfg.Name] = j
+			continue
+		}
+
+		delete(d.jobs, cfg.Name)
+		next[cfg.Name] = j
+		old := j.cfg.Swap(cfg)
+		if old.BackupInterval != cfg.BackupInterval {
+			replace(j.interval, cfg.BackupInterval)
+		}
+		if old.ScrubInterval != cfg.ScrubInterval {
+			replace(j.scrubInterval, cfg.ScrubInterval)
+		}
+	}
+
+	for name, j := range d.jobs {
+		slog.Info("➖ 移除备份任务", "job", name)
+		if j.cancel != nil {
+			j.cancel()
+		}
+	}
+	d.jobs = next
+}
+
+// replace 只保留最新的间隔
+func replace(ch chan time.Duration, interval time.Duration) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- interval
+}
+
+// Wait 等待调度停止和正在进行的备份完成，超时返回 false
+func (d *Daemon) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.loops.Wait()
+		d.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Alive 确认每个任务的定时循环都能在 timeout 内响应
+func (d *Daemon) Alive(timeout time.Duration) error {
+	d.mu.Lock()
+	jobs := make(map[string]*job, len(d.jobs))
+	for name, j := range d.jobs {
+		jobs[name] = j
+	}
+	d.mu.Unlock()
+
+	deadline := time.After(timeout)
+	for name, j := range jobs {
+		reply := make(chan struct{})
+		select {
+		case j.probe <- reply:
+		case <-deadline:
+			return fmt.Errorf("任务 %s 的定时循环无响应", name)
+		}
+		select {
+		case <-reply:
+		case <-deadline:
+			return fmt.Errorf("任务 %s 的定时循环无响应", name)
+		}
+	}
+	return nil
+}
+
+// Status 返回所有任务的状态，按名称排序
+func (d *Daemon) Status() []JobStatus {
+	d.mu.Lock()
+	jobs := make([]*job, 0, len(d.jobs))
+	for _, j := range d.jobs {
+		jobs = append(jobs, j)
+	}
+	d.mu.Unlock()
+
+	now := time.Now()
+	status := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		cfg := j.cfg.Load()
+
+		j.mu.Lock()
+		s := JobStatus{
+			Name:        cfg.Name,
+			BackupName:  cfg.BackupName,
+			Interval:    cfg.BackupInterval.String(),
+			MaxAge:      cfg.HealthMaxAge.String(),
+			Running:     j.running.Load(),
+			Ready:       !j.lastSuccess.IsZero() && now.Sub(j.lastSuccess) <= cfg.HealthMaxAge,
+			LastRun:     timePtr(j.lastRun),
+			LastSuccess: timePtr(j.lastSuccess),
+			LastError:   j.lastError,
+			NextRun:     timePtr(j.next),
+			LastScrub:   timePtr(j.lastScrub),
+		}
+		j.mu.Unlock()
+
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(a, b int) bool { return status[a].Name < status[b].Name })
+	return status
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// setNext 记录下一次定时备份的时间
+func (j *job) setNext(t time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.next = t
+}
+
+// record 记录一次备份的结果
+func (j *job) record(rep *report.Report) {
+	snap := rep.Snapshot()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.lastRun = snap.End
+	j.lastError = snap.Error
+	if snap.Error == "" {
+		j.lastSuccess = snap.End
+	}
+}
+
+// start 启动任务的定时循环，调用方需持有 d.mu
+func (d *Daemon) start(j *job, initial bool) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	j.cancel = cancel
+
+	d.loops.Add(1)
+	go func() {
+		defer d.loops.Done()
+		d.loop(ctx, j, initial)
+	}()
+}
+
+// loop 单个任务的定时循环
+func (d *Daemon) loop(ctx context.Context, j *job, initial bool) {
+	cfg := j.cfg.Load()
+	if initial {
+		slog.Info("📦 执行初始备份", "job", cfg.Name)
+		d.trigger(ctx, j, "初始备份")
+	}
+
+	ticker := time.NewTicker(cfg.BackupInterval)
+	defer ticker.Stop()
+	j.setNext(time.Now().Add(cfg.BackupInterval))
+
+	slog.Info("⏰ 定时备份已启动", "job", cfg.Name, "interval", cfg.BackupInterval)
+
+	// 巡检不在启动时立即执行，避免与初始备份争抢 I/O
+	var scrubTicker *time.Ticker
+	var scrubC <-chan time.Time
+	setScrub := func(interval time.Duration) {
+		if scrubTicker != nil {
+			scrubTicker.Stop()
+			scrubTicker, scrubC = nil, nil
+		}
+		if interval > 0 {
+			scrubTicker = time.NewTicker(interval)
+			scrubC = scrubTicker.C
+			slog.Info("⏰ 定时巡检已启动", "job", cfg.Name, "interval", interval)
+		}
+	}
+	setScrub(cfg.ScrubInterval)
+	defer setScrub(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reply := <-j.probe:
+			close(reply)
+		case interval := <-j.interval:
+			ticker.Reset(interval)
+			j.setNext(time.Now().Add(interval))
+			slog.Info("⏰ 备份间隔已更新", "job", cfg.Name, "interval", interval)
+		case interval := <-j.scrubInterval:
+			setScrub(interval)
+			if interval == 0 {
+				slog.Info("⏰ 定时巡检已停止", "job", cfg.Name)
+			}
+		case t := <-ticker.C:
+			j.setNext(t.Add(j.cfg.Load().BackupInterval))
+			slog.Debug("🔄 开始定时备份", "job", cfg.Name)
+			d.trigger(ctx, j, "定时备份")
+		case <-scrubC:
+			d.scrub(ctx, j)
+		}
+	}
+}
+
+// trigger 在后台执行一次备份，同一任务的上一次备份未完成时跳过
+func (d *Daemon) trigger(ctx context.Context, j *job, kind string) {
+	cfg := j.cfg.Load()
+	if !j.running.CompareAndSwap(false, true) {
+		slog.Debug("⏭️ 跳过定时备份，上一个备份仍在进行中", "job", cfg.Name)
+		return
+	}
+
+	d.runs.Add(1)
+	go func() {
+		defer d.runs.Done()
+
+		cfg, rep, ok := d.run(ctx, j, kind)
+		if !ok {
+			return
+		}
+
+		// 通知可能因目标超时耗时较久，此时并发名额和运行标志已释放，不会推迟下一次备份
+		j.observing.Lock()
+		defer j.observing.Unlock()
+		for _, o := range d.observers {
+			o(cfg, rep)
+		}
+	}()
+}
+
+// run 等待并发名额后执行一次备份，返回时释放名额和运行标志；ctx 在排队期间取消时返回 false
+func (d *Daemon) run(ctx context.Context, j *job, kind string) (*config.Config, *report.Report, bool) {
+	defer j.running.Store(false)
+
+	// 等待空闲的并发名额
+	if !d.sem.acquire(ctx) {
+		return nil, nil, false
+	}
+	defer d.sem.release()
+
+	// 排队期间可能已重新加载，使用最新的配置
+	// 备份不随调度停止而中断，关闭时由 Wait 等待其完成
+	cfg := j.cfg.Load()
+	j.archives.Lock()
+	rep, err := app.New(cfg).Run(context.WithoutCancel(ctx))
+	j.archives.Unlock()
+	if err != nil {
+		slog.Error("🚨 "+kind+"失败", "job", cfg.Name, "run_id", rep.ID, "error", err)
+	}
+	j.record(rep)
+	return cfg, rep, true
+}
+
+// scrub 在后台重新校验任务的已有归档，上一次巡检未完成时跳过。
+// 巡检不占用备份的并发名额，关闭服务时随 ctx 中止
+func (d *Daemon) scrub(ctx context.Context, j *job) {
+	cfg := j.cfg.Load()
+	if !j.scrubbing.CompareAndSwap(false, true) {
+		slog.Debug("⏭️ 跳过定时巡检，上一次巡检仍在进行中", "job", cfg.Name)
+		return
+	}
+
+	d.runs.Add(1)
+	go func() {
+		defer d.runs.Done()
+		defer j.scrubbing.Store(false)
+
+		rep, err := scrub.Run(ctx, cfg, &j.archives)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("🚨 巡检失败", "job", cfg.Name, "run_id", rep.ID, "error", err)
+			}
+			return
+		}
+
+		j.mu.Lock()
+		j.lastScrub = rep.Snapshot().End
+		j.mu.Unlock()
+		for _, o := range d.scrubObservers {
+			o(cfg, rep)
+		}
+	}()
+}
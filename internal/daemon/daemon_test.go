@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+)
+
+// receive 等待 ch，超时时测试失败
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+		panic("unreachable")
+	}
+}
+
+func TestObserversDoNotHoldSlot(t *testing.T) {
+	// 数据目录不存在，备份很快失败，但仍会调用观察者
+	cfg := &config.Config{
+		Name:           "vault",
+		BackupName:     "vault",
+		DataDir:        filepath.Join(t.TempDir(), "missing"),
+		BackupDir:      t.TempDir(),
+		TmpDir:         t.TempDir(),
+		BackupInterval: time.Hour,
+	}
+	d := New(&config.Settings{MaxConcurrentJobs: 1, Jobs: []*config.Config{cfg}})
+
+	observed := make(chan *report.Report)
+	release := make(chan struct{})
+	d.OnRun(func(_ *config.Config, rep *report.Report) {
+		observed <- rep
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	j := d.jobs["vault"]
+
+	d.trigger(ctx, j, "测试备份")
+	first := receive(t, observed)
+
+	// 观察者仍在阻塞，此时名额和运行标志应已释放
+	if j.running.Load() {
+		t.Error("job is still marked running while observers are notified")
+	}
+	if n := d.sem.running(); n != 0 {
+		t.Errorf("%d concurrency slots held while observers are notified", n)
+	}
+
+	// 下一次备份可以开始，其观察者等上一次的观察者结束后才调用
+	d.trigger(ctx, j, "测试备份")
+	select {
+	case <-observed:
+		t.Fatal("observers of the second run were called before the first ones returned")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	second := receive(t, observed)
+	if first.ID == second.ID {
+		t.Error("the second trigger did not start a new run")
+	}
+
+	if !d.Wait(10 * time.Second) {
+		t.Fatal("runs did not finish")
+	}
+}
@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+)
+
+// limiter 限制同时运行的备份数量。上限可在运行中修改：调低后正在进行的备份不受影响，
+// 但在运行数量降到新上限以下之前不会开始新的备份
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active int // 正在运行的备份数量
+	limit  int
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire 等待空闲名额，ctx 在等待期间取消时返回 false
+func (l *limiter) acquire(ctx context.Context) bool {
+	// 取消时唤醒等待者；广播前先获取锁，保证不会在检查 ctx 与进入 Wait 之间丢失
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+	l.active++
+	return true
+}
+
+// release 归还名额
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// setLimit 修改上限，调高时立即唤醒排队的备份
+func (l *limiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+// running 返回正在运行的备份数量
+func (l *limiter) running() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
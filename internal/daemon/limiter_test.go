@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquireAsync 在后台获取名额，返回接收结果的通道
+func acquireAsync(ctx context.Context, l *limiter) <-chan bool {
+	done := make(chan bool, 1)
+	go func() { done <- l.acquire(ctx) }()
+	return done
+}
+
+// blocked 确认 ch 在短时间内没有结果
+func blocked(t *testing.T, ch <-chan bool) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatal("acquire returned while the limit was reached")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLimiterLowerLimit(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(2)
+	l.acquire(ctx)
+	l.acquire(ctx)
+
+	// 调低上限不影响已在运行的备份，但在运行数量低于新上限前不能开始新的备份
+	l.setLimit(1)
+	waiting := acquireAsync(ctx, l)
+	blocked(t, waiting)
+
+	l.release()
+	blocked(t, waiting)
+
+	l.release()
+	if !receive(t, waiting) {
+		t.Fatal("acquire failed")
+	}
+	if n := l.running(); n != 1 {
+		t.Errorf("running = %d, want 1", n)
+	}
+}
+
+func TestLimiterRaiseLimit(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(1)
+	l.acquire(ctx)
+
+	waiting := acquireAsync(ctx, l)
+	blocked(t, waiting)
+
+	l.setLimit(2)
+	if !receive(t, waiting) {
+		t.Fatal("acquire failed")
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := newLimiter(1)
+	l.acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := acquireAsync(ctx, l)
+	blocked(t, waiting)
+
+	cancel()
+	if receive(t, waiting) {
+		t.Fatal("acquire succeeded after cancellation")
+	}
+	if n := l.running(); n != 1 {
+		t.Errorf("running = %d, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Engine 数据库类型
+type Engine string
+
+const (
+	SQLite     Engine = "sqlite"
+	PostgreSQL Engine = "postgresql"
+	MySQL      Engine = "mysql"
+)
+
+// InfoFile 归档中记录数据库信息的文件名
+const InfoFile = "database.json"
+
+// Info 记录在归档中的数据库元数据
+type Info struct {
+	Engine  Engine `json:"engine"`  // 数据库类型
+	Version string `json:"version"` // 数据库服务器版本
+	Dump    string `json:"dump"`    // 导出文件名
+}
+
+// Backend 某种数据库的导出与导入实现
+type Backend interface {
+	// Engine 返回数据库类型
+	Engine() Engine
+	// Dump 将数据库一致性地导出到 destDir
+	Dump(destDir string) error
+	// Restore 将 srcDir 中的导出文件导入数据库
+	Restore(srcDir string) error
+	// Clear 删除 Restore 导入的表，用于恢复中途失败时回滚；导入前数据库必须为空
+	Clear() error
+	// Version 返回数据库服务器版本
+	Version() (string, error)
+}
+
+// DumpFile 返回各数据库导出文件在归档中的文件名
+func DumpFile(engine Engine) string {
+	switch engine {
+	case PostgreSQL:
+		return "db.postgresql.sql"
+	case MySQL:
+		return "db.mysql.sql"
+	default:
+		return "db.sqlite3"
+	}
+}
+
+// Detect 根据 Vaultwarden 的 DATABASE_URL 判断数据库类型，空值或文件路径视为 SQLite
+func Detect(databaseURL string) Engine {
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		return PostgreSQL
+	case strings.HasPrefix(databaseURL, "mysql://"):
+		return MySQL
+	default:
+		return SQLite
+	}
+}
+
+// New 根据 DATABASE_URL 创建对应的数据库后端，SQLite 未指定路径时使用 dataDir/db.sqlite3
+func New(databaseURL, dataDir string) Backend {
+	switch Detect(databaseURL) {
+	case PostgreSQL:
+		return &postgres{url: databaseURL}
+	case MySQL:
+		return &mysql{url: databaseURL}
+	default:
+		path := strings.TrimPrefix(databaseURL, "sqlite://")
+		if path == "" {
+			path = filepath.Join(dataDir, "db.sqlite3")
+		}
+		return &sqlite{path: path}
+	}
+}
+
+// WriteInfo 将数据库元数据写入 dir
+func WriteInfo(dir string, info Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, InfoFile), data, 0644)
+}
+
+// ReadInfo 读取 dir 中的数据库元数据，旧版本归档中不存在该文件
+func ReadInfo(dir string) (Info, error) {
+	data, err := os.ReadFile(filepath.Join(dir, InfoFile))
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, fmt.Errorf("解析 %s 失败: %w", InfoFile, err)
+	}
+	return info, nil
+}
+
+// DetectDump 检查目录中包含哪种数据库的导出文件
+func DetectDump(dir string) (Engine, bool) {
+	if info, err := ReadInfo(dir); err == nil && info.Engine != "" {
+		return info.Engine, true
+	}
+	for _, engine := range []Engine{SQLite, PostgreSQL, MySQL} {
+		if _, err := os.Stat(filepath.Join(dir, DumpFile(engine))); err == nil {
+			return engine, true
+		}
+	}
+	return "", false
+}
+
+// run 执行外部命令，失败时附带命令的错误输出
+func run(cmd *exec.Cmd) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s 执行失败: %w: %s", filepath.Base(cmd.Path), err, msg)
+		}
+		return "", fmt.Errorf("%s 执行失败: %w", filepath.Base(cmd.Path), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
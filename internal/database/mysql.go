@@ -0,0 +1,146 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// mysql 使用 mysqldump/mysql（或 MariaDB 对应的客户端）导出和导入 MySQL/MariaDB 数据库
+type mysql struct {
+	url string // DATABASE_URL
+}
+
+func (m *mysql) Engine() Engine { return MySQL }
+
+// Dump 使用 --single-transaction 在一致性快照中导出全部数据
+func (m *mysql) Dump(destDir string) error {
+	cmd, err := m.command(lookClient("mariadb-dump", "mysqldump"),
+		"--single-transaction",
+		"--routines",
+		"--triggers",
+		"--events",
+		"--hex-blob",
+		"--no-tablespaces",
+		"--default-character-set=utf8mb4",
+		"--result-file="+filepath.Join(destDir, DumpFile(MySQL)),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = run(cmd)
+	return err
+}
+
+// Restore 将导出文件导入空数据库。MySQL 的 DDL 会隐式提交，无法像 PostgreSQL 一样在单个事务中导入，
+// 因此导入失败时删除已创建的表，使数据库回到空状态，修正问题后可以直接重试
+func (m *mysql) Restore(srcDir string) error {
+	count, err := m.query("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE()")
+	if err != nil {
+		return err
+	}
+	if count != "0" {
+		return fmt.Errorf("目标数据库不为空（包含 %s 张表），请先创建一个空数据库", count)
+	}
+
+	dump, err := os.Open(filepath.Join(srcDir, DumpFile(MySQL)))
+	if err != nil {
+		return fmt.Errorf("打开数据库导出文件失败: %w", err)
+	}
+	defer dump.Close()
+
+	cmd, err := m.command(lookClient("mariadb", "mysql"), "--default-character-set=utf8mb4")
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = dump
+
+	if _, err := run(cmd); err != nil {
+		if cerr := m.Clear(); cerr != nil {
+			return fmt.Errorf("%w；删除已导入的表也失败，请手动清空数据库后重试: %v", err, cerr)
+		}
+		return fmt.Errorf("%w；已删除导入了一部分的表", err)
+	}
+	return nil
+}
+
+// Clear 删除当前数据库中的所有表和视图，使数据库回到导入前的空状态
+func (m *mysql) Clear() error {
+	for _, kind := range []struct{ tableType, drop string }{
+		{"VIEW", "VIEW"},
+		{"BASE TABLE", "TABLE"},
+	} {
+		names, err := m.query("SET SESSION group_concat_max_len = 1048576; SELECT GROUP_CONCAT(CONCAT('`', REPLACE(table_name, '`', '``'), '`')) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = '" + kind.tableType + "'")
+		if err != nil {
+			return err
+		}
+		if names == "" || names == "NULL" {
+			continue
+		}
+		if _, err := m.query("SET FOREIGN_KEY_CHECKS = 0; DROP " + kind.drop + " IF EXISTS " + names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Version 返回数据库服务器版本
+func (m *mysql) Version() (string, error) {
+	return m.query("SELECT VERSION()")
+}
+
+// query 使用 mysql 客户端执行查询并返回单个结果
+func (m *mysql) query(sql string) (string, error) {
+	cmd, err := m.command(lookClient("mariadb", "mysql"), "--batch", "--skip-column-names", "--execute="+sql)
+	if err != nil {
+		return "", err
+	}
+	return run(cmd)
+}
+
+// command 构造 MySQL 客户端命令，密码通过 MYSQL_PWD 传递以免出现在进程列表中
+func (m *mysql) command(name string, args ...string) (*exec.Cmd, error) {
+	// 解析错误中会包含完整 URL，不能直接返回以免泄露密码
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 DATABASE_URL")
+	}
+
+	database := strings.TrimPrefix(u.Path, "/")
+	if database == "" {
+		return nil, fmt.Errorf("DATABASE_URL 中缺少数据库名")
+	}
+
+	env := os.Environ()
+	var connArgs []string
+	if host := u.Hostname(); host != "" {
+		connArgs = append(connArgs, "--host="+host)
+	}
+	if port := u.Port(); port != "" {
+		connArgs = append(connArgs, "--port="+port)
+	}
+	if u.User != nil {
+		connArgs = append(connArgs, "--user="+u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			env = append(env, "MYSQL_PWD="+password)
+		}
+	}
+
+	cmd := exec.Command(name, append(append(connArgs, args...), database)...)
+	cmd.Env = env
+	return cmd, nil
+}
+
+// lookClient 返回 PATH 中第一个存在的客户端程序，MariaDB 新版本已改用 mariadb-* 命名
+func lookClient(names ...string) string {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return names[len(names)-1]
+}
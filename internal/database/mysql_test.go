@@ -0,0 +1,106 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeMySQLDump 在临时目录中写入一个导出文件
+func writeMySQLDump(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, DumpFile(MySQL)), []byte("CREATE TABLE users (uuid CHAR(36));\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMySQLConnectionArguments(t *testing.T) {
+	calls := stubClients(t, "mysql")
+	t.Setenv("STUB_VERSION", "8.0.36")
+
+	version, err := New("mysql://vw:s3cr%40t@db:3307/vaultwarden", "").Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "8.0.36" {
+		t.Errorf("version = %q", version)
+	}
+
+	log := calls()
+	assertContains(t, log, "[--host=db] [--port=3307] [--user=vw]")
+	assertContains(t, log, "[vaultwarden]")
+	assertContains(t, log, "MYSQL_PWD=s3cr@t")
+	assertNotContains(t, strings.SplitN(log, "\n", 2)[0], "s3cr")
+}
+
+func TestMySQLRequiresDatabaseName(t *testing.T) {
+	stubClients(t, "mysql")
+
+	_, err := New("mysql://vw:pw@db:3306", "").Version()
+	if err == nil || !strings.Contains(err.Error(), "缺少数据库名") {
+		t.Fatalf("err = %v, want missing database name", err)
+	}
+}
+
+func TestMySQLPrefersMariaDBClient(t *testing.T) {
+	calls := stubClients(t, "mysql", "mariadb")
+
+	if _, err := New("mysql://vw@db/vaultwarden", "").Version(); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, calls(), "call: mariadb ")
+}
+
+func TestMySQLRestoreRefusesNonEmptyDatabase(t *testing.T) {
+	calls := stubClients(t, "mysql")
+	t.Setenv("STUB_TABLES", "12")
+
+	err := New("mysql://vw:pw@db/vaultwarden", "").Restore(writeMySQLDump(t))
+	if err == nil || !strings.Contains(err.Error(), "不为空") {
+		t.Fatalf("err = %v, want non-empty refusal", err)
+	}
+	if _, err := os.Stat(os.Getenv("STUB_LOG") + ".stdin"); err == nil {
+		t.Error("dump was imported into a non-empty database")
+	}
+	assertNotContains(t, calls(), "DROP")
+}
+
+func TestMySQLRestore(t *testing.T) {
+	calls := stubClients(t, "mysql")
+
+	if err := New("mysql://vw:pw@db/vaultwarden", "").Restore(writeMySQLDump(t)); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.ReadFile(os.Getenv("STUB_LOG") + ".stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stdin), "CREATE TABLE users") {
+		t.Errorf("import stdin = %q", stdin)
+	}
+	assertNotContains(t, calls(), "DROP")
+}
+
+func TestMySQLRestoreFailureDropsImportedTables(t *testing.T) {
+	calls := stubClients(t, "mysql")
+	t.Setenv("STUB_IMPORT_FAIL", "ERROR 1064 at line 2")
+	t.Setenv("STUB_TABLE_NAMES", "`users`,`ciphers`")
+
+	err := New("mysql://vw:pw@db/vaultwarden", "").Restore(writeMySQLDump(t))
+	if err == nil || !strings.Contains(err.Error(), "ERROR 1064") || !strings.Contains(err.Error(), "已删除") {
+		t.Fatalf("err = %v, want import error after cleanup", err)
+	}
+	assertContains(t, calls(), "DROP TABLE IF EXISTS `users`,`ciphers`")
+}
+
+func TestMySQLClearEmptyDatabase(t *testing.T) {
+	calls := stubClients(t, "mysql")
+
+	if err := New("mysql://vw:pw@db/vaultwarden", "").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	assertNotContains(t, calls(), "DROP")
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// postgres 使用 pg_dump/psql 导出和导入 PostgreSQL 数据库
+type postgres struct {
+	url string // DATABASE_URL
+}
+
+func (p *postgres) Engine() Engine { return PostgreSQL }
+
+// Dump 使用 pg_dump 导出一致性快照（pg_dump 在单个事务中读取全部数据）
+func (p *postgres) Dump(destDir string) error {
+	cmd, err := p.command("pg_dump",
+		"--format=plain",
+		"--no-owner",
+		"--no-privileges",
+		"--file="+filepath.Join(destDir, DumpFile(PostgreSQL)),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = run(cmd)
+	return err
+}
+
+// Restore 将导出文件导入空数据库，整个导入在单个事务中完成
+func (p *postgres) Restore(srcDir string) error {
+	count, err := p.query("SELECT count(*) FROM information_schema.tables WHERE table_schema NOT IN ('pg_catalog', 'information_schema')")
+	if err != nil {
+		return err
+	}
+	if count != "0" {
+		return fmt.Errorf("目标数据库不为空（包含 %s 张表），请先创建一个空数据库", count)
+	}
+
+	cmd, err := p.command("psql",
+		"--quiet",
+		"--no-psqlrc",
+		"--single-transaction",
+		"--set=ON_ERROR_STOP=1",
+		"--file="+filepath.Join(srcDir, DumpFile(PostgreSQL)),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = run(cmd)
+	return err
+}
+
+// clearSQL 删除所有非系统 schema 中的视图、表和序列；Restore 只在空数据库上导入，这些对象都来自导入
+const clearSQL = `DO $$
+DECLARE r record;
+BEGIN
+	FOR r IN SELECT schemaname, viewname FROM pg_views WHERE schemaname NOT IN ('pg_catalog', 'information_schema') LOOP
+		EXECUTE format('DROP VIEW IF EXISTS %I.%I CASCADE', r.schemaname, r.viewname);
+	END LOOP;
+	FOR r IN SELECT schemaname, tablename FROM pg_tables WHERE schemaname NOT IN ('pg_catalog', 'information_schema') LOOP
+		EXECUTE format('DROP TABLE IF EXISTS %I.%I CASCADE', r.schemaname, r.tablename);
+	END LOOP;
+	FOR r IN SELECT schemaname, sequencename FROM pg_sequences WHERE schemaname NOT IN ('pg_catalog', 'information_schema') LOOP
+		EXECUTE format('DROP SEQUENCE IF EXISTS %I.%I CASCADE', r.schemaname, r.sequencename);
+	END LOOP;
+END $$`
+
+// Clear 删除导入的表，使数据库回到导入前的空状态
+func (p *postgres) Clear() error {
+	cmd, err := p.command("psql", "--quiet", "--no-psqlrc", "--set=ON_ERROR_STOP=1", "--command="+clearSQL)
+	if err != nil {
+		return err
+	}
+	_, err = run(cmd)
+	return err
+}
+
+// Version 返回数据库服务器版本
+func (p *postgres) Version() (string, error) {
+	return p.query("SHOW server_version")
+}
+
+// query 使用 psql 执行查询并返回单个结果
+func (p *postgres) query(sql string) (string, error) {
+	cmd, err := p.command("psql", "--no-psqlrc", "--tuples-only", "--no-align", "--command="+sql)
+	if err != nil {
+		return "", err
+	}
+	return run(cmd)
+}
+
+// command 构造 PostgreSQL 客户端命令，密码通过 PGPASSWORD 传递以免出现在进程列表中
+func (p *postgres) command(name string, args ...string) (*exec.Cmd, error) {
+	// 解析错误中会包含完整 URL，不能直接返回以免泄露密码
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 DATABASE_URL")
+	}
+
+	env := os.Environ()
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			env = append(env, "PGPASSWORD="+password)
+		}
+		u.User = url.User(u.User.Username())
+	}
+
+	cmd := exec.Command(name, append([]string{"--dbname=" + u.String()}, args...)...)
+	cmd.Env = env
+	return cmd, nil
+}
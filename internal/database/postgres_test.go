@@ -0,0 +1,143 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Engine
+	}{
+		{"", SQLite},
+		{"/data/db.sqlite3", SQLite},
+		{"sqlite:///data/db.sqlite3", SQLite},
+		{"postgres://vw:pw@db/vaultwarden", PostgreSQL},
+		{"postgresql://vw@db:5433/vaultwarden?sslmode=require", PostgreSQL},
+		{"mysql://vw:pw@db/vaultwarden", MySQL},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.url); got != tt.want {
+			t.Errorf("Detect(%q) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNewSQLitePath(t *testing.T) {
+	tests := []struct {
+		url, dataDir, want string
+	}{
+		{"", "/data", "/data/db.sqlite3"},
+		{"/var/lib/vw.db", "/data", "/var/lib/vw.db"},
+		{"sqlite:///var/lib/vw.db", "/data", "/var/lib/vw.db"},
+	}
+	for _, tt := range tests {
+		b, ok := New(tt.url, tt.dataDir).(*sqlite)
+		if !ok {
+			t.Fatalf("New(%q) is not sqlite", tt.url)
+		}
+		if b.path != tt.want {
+			t.Errorf("New(%q).path = %s, want %s", tt.url, b.path, tt.want)
+		}
+	}
+}
+
+func TestPostgresPasswordInEnvironment(t *testing.T) {
+	calls := stubClients(t, "psql")
+	t.Setenv("STUB_VERSION", "16.2")
+
+	p := New("postgres://vw:s3cr%40t@db:5432/vaultwarden?sslmode=disable", "").(*postgres)
+	version, err := p.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "16.2" {
+		t.Errorf("version = %q", version)
+	}
+
+	log := calls()
+	assertContains(t, log, "[--dbname=postgres://vw@db:5432/vaultwarden?sslmode=disable]")
+	assertContains(t, log, "PGPASSWORD=s3cr@t ")
+	assertNotContains(t, strings.SplitN(log, "\n", 2)[0], "s3cr")
+}
+
+func TestPostgresWithoutPassword(t *testing.T) {
+	calls := stubClients(t, "psql")
+
+	if _, err := New("postgresql://vw@db/vaultwarden", "").Version(); err != nil {
+		t.Fatal(err)
+	}
+	log := calls()
+	assertContains(t, log, "[--dbname=postgresql://vw@db/vaultwarden]")
+	assertContains(t, log, "PGPASSWORD= ")
+}
+
+func TestPostgresInvalidURLHidesPassword(t *testing.T) {
+	stubClients(t, "psql")
+
+	_, err := New("postgres://vw:topsecret@db:notaport/vaultwarden", "").Version()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assertNotContains(t, err.Error(), "topsecret")
+}
+
+func TestPostgresDump(t *testing.T) {
+	calls := stubClients(t, "pg_dump")
+	dir := t.TempDir()
+
+	if err := New("postgres://vw:pw@db/vaultwarden", "").Dump(dir); err != nil {
+		t.Fatal(err)
+	}
+	log := calls()
+	assertContains(t, log, "call: pg_dump")
+	assertContains(t, log, "[--file="+filepath.Join(dir, "db.postgresql.sql")+"]")
+	assertContains(t, log, "[--no-owner]")
+}
+
+func TestPostgresRestoreRefusesNonEmptyDatabase(t *testing.T) {
+	calls := stubClients(t, "psql")
+	t.Setenv("STUB_TABLES", "3")
+
+	err := New("postgres://vw:pw@db/vaultwarden", "").Restore(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "不为空") {
+		t.Fatalf("err = %v, want non-empty refusal", err)
+	}
+	assertNotContains(t, calls(), "--single-transaction")
+}
+
+func TestPostgresRestore(t *testing.T) {
+	calls := stubClients(t, "psql")
+	dir := t.TempDir()
+
+	if err := New("postgres://vw:pw@db/vaultwarden", "").Restore(dir); err != nil {
+		t.Fatal(err)
+	}
+	log := calls()
+	assertContains(t, log, "[--single-transaction]")
+	assertContains(t, log, "[--set=ON_ERROR_STOP=1]")
+	assertContains(t, log, "[--file="+filepath.Join(dir, "db.postgresql.sql")+"]")
+}
+
+func TestPostgresRestoreFailure(t *testing.T) {
+	stubClients(t, "psql")
+	t.Setenv("STUB_IMPORT_FAIL", "ERROR: syntax error")
+
+	err := New("postgres://vw:pw@db/vaultwarden", "").Restore(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("err = %v, want psql error output", err)
+	}
+}
+
+func TestPostgresClear(t *testing.T) {
+	calls := stubClients(t, "psql")
+
+	if err := New("postgres://vw:pw@db/vaultwarden", "").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	log := calls()
+	assertContains(t, log, "DROP TABLE IF EXISTS")
+	assertContains(t, log, "PGPASSWORD=pw ")
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+)
+
+// sqlite Vaultwarden 默认的 SQLite 数据库
+type sqlite struct {
+	path string // 数据库文件路径
+}
+
+func (s *sqlite) Engine() Engine { return SQLite }
+
+// Dump 使用在线备份 API 复制数据库并验证完整性
+func (s *sqlite) Dump(destDir string) error {
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return fmt.Errorf("❌ 数据库文件 %s 不存在", s.path)
+	}
+
+	dest := filepath.Join(destDir, DumpFile(SQLite))
+	if err := utils.BackupSQLite(s.path, dest); err != nil {
+		return err
+	}
+
+	// 验证备份文件的完整性
+	return utils.CheckSQLiteIntegrity(dest)
+}
+
+// Restore 仅验证导出文件，SQLite 数据库文件随数据目录一起替换
+func (s *sqlite) Restore(srcDir string) error {
+	return utils.CheckSQLiteIntegrity(filepath.Join(srcDir, DumpFile(SQLite)))
+}
+
+// Clear SQLite 的 Restore 不修改数据库，无需回滚
+func (s *sqlite) Clear() error { return nil }
+
+// Version 返回内置 SQLite 库的版本
+func (s *sqlite) Version() (string, error) {
+	return utils.SQLiteVersion(s.path)
+}
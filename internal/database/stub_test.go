@@ -0,0 +1,74 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubScript 代替数据库客户端：记录参数和密码环境变量，按查询内容输出 STUB_* 环境变量指定的结果
+const stubScript = `#!/bin/sh
+{
+	printf 'call: %s' "$(basename "$0")"
+	for a in "$@"; do printf ' [%s]' "$a"; done
+	printf '\n'
+	printf 'env: PGPASSWORD=%s MYSQL_PWD=%s\n' "$PGPASSWORD" "$MYSQL_PWD"
+} >> "$STUB_LOG"
+case "$*" in
+*GROUP_CONCAT*)
+	echo "${STUB_TABLE_NAMES:-NULL}" ;;
+*"count(*)"*|*"COUNT(*)"*)
+	echo "${STUB_TABLES:-0}" ;;
+*server_version*|*"VERSION()"*)
+	echo "${STUB_VERSION:-0}" ;;
+*--command=*|*--execute=*)
+	;;
+*)
+	# 导入或导出
+	[ -t 0 ] || cat > "$STUB_LOG.stdin"
+	if [ -n "$STUB_IMPORT_FAIL" ]; then
+		echo "$STUB_IMPORT_FAIL" >&2
+		exit 1
+	fi ;;
+esac
+`
+
+// stubClients 在 PATH 最前面放置同名脚本代替客户端程序，返回读取调用日志的函数
+func stubClients(t *testing.T, names ...string) func() string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(stubScript), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logFile := filepath.Join(dir, "calls.log")
+	t.Setenv("STUB_LOG", logFile)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("PGPASSWORD", "")
+	t.Setenv("MYSQL_PWD", "")
+
+	return func() string {
+		data, err := os.ReadFile(logFile)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
+
+func assertContains(t *testing.T, s, want string) {
+	t.Helper()
+	if !strings.Contains(s, want) {
+		t.Errorf("missing %q in:\n%s", want, s)
+	}
+}
+
+func assertNotContains(t *testing.T, s, unwanted string) {
+	t.Helper()
+	if strings.Contains(s, unwanted) {
+		t.Errorf("unexpected %q in:\n%s", unwanted, s)
+	}
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/xg4/vaultwarden-backup/internal/report"
+)
+
+type attrsKey struct{}
+
+// With 返回携带日志属性的 context，通过 slog.*Context 记录的日志会自动带上这些属性，
+// 如一次运行的 run_id、job 和当前的 task
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := append(attrs[:len(attrs):len(attrs)], slog.Group("", args...).Value.Group()...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+// contextHandler 为日志添加 context 中的属性，并将运行期间的日志记入运行报告
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if rep := report.FromContext(ctx); rep != nil {
+		rep.AddLog(formatLine(ctx, r))
+	}
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// formatLine 以文本格式输出一行日志，不带 context 中的属性
+func formatLine(ctx context.Context, r slog.Record) string {
+	var b bytes.Buffer
+	slog.NewTextHandler(&b, nil).Handle(ctx, r)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -1,21 +1,45 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
+	"strconv"
 )
 
-// Setup 初始化并配置日志记录器
+// Setup 初始化并配置日志记录器：LOG_LEVEL 日志级别，LOG_FORMAT 输出格式（text 或 json），
+// LOG_FILE 额外写入的日志文件，按 LOG_FILE_MAX_SIZE（MB）轮转并保留 LOG_FILE_MAX_BACKUPS 个旧文件
 func Setup() {
 	logLevel := getLogLevel()
 	opts := &slog.HandlerOptions{
 		Level: logLevel,
 	}
 
-	handler := slog.NewTextHandler(os.Stdout, opts)
-	slog.SetDefault(slog.New(handler))
+	var out io.Writer = os.Stdout
+	var fileErr error
+	if path := os.Getenv("LOG_FILE"); path != "" {
+		maxSize := getIntEnv("LOG_FILE_MAX_SIZE", 10)
+		backups := getIntEnv("LOG_FILE_MAX_BACKUPS", 5)
+		file, err := openRotating(path, int64(maxSize)<<20, backups)
+		if err == nil {
+			out = io.MultiWriter(os.Stdout, file)
+		}
+		fileErr = err
+	}
+
+	var handler slog.Handler
+	switch os.Getenv("LOG_FORMAT") {
+	case "json", "JSON":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(&contextHandler{Handler: handler}))
 
 	slog.Info("📝 日志级别已设置", "level", logLevel.String())
+	if fileErr != nil {
+		slog.Warn("⚠️ 无法打开日志文件，仅输出到标准输出", "error", fileErr)
+	}
 }
 
 // getLogLevel 根据环境变量设置日志级别
@@ -34,3 +58,12 @@ func getLogLevel() slog.Level {
 		return slog.LevelInfo
 	}
 }
+
+// getIntEnv 读取非负整数环境变量，无效时使用默认值
+func getIntEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xg4/vaultwarden-backup/internal/report"
+)
+
+// readFile 读取文件内容，文件不存在时返回空字符串
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.log")
+	w, err := openRotating(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { w.file.Close() }()
+
+	// 每行 6 字节，第二行写入后即将超过 10 字节，因此每行一个文件
+	for i := 1; i <= 5; i++ {
+		if _, err := fmt.Fprintf(w, "line%d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "line5\n",
+		path + ".1": "line4\n",
+		path + ".2": "line3\n",
+		path + ".3": "", // 超出保留数量的旧文件被删除
+	}
+	for p, content := range want {
+		if got := readFile(t, p); got != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, content)
+		}
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开时沿用已有文件的大小
+	w, err := openRotating(path, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { w.file.Close() }()
+	if _, err := w.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "old\nnew\n" {
+		t.Errorf("log = %q, want appended", got)
+	}
+
+	if _, err := w.Write([]byte("next\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "next\n" {
+		t.Errorf("log = %q after rotation", got)
+	}
+	if got := readFile(t, path+".1"); got != "old\nnew\n" {
+		t.Errorf("log.1 = %q", got)
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup.log")
+	w, err := openRotating(path, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { w.file.Close() }()
+
+	// 单行超过上限时仍完整写入，不会反复轮转
+	for _, line := range []string{"first line\n", "second line\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, path); got != "second line\n" {
+		t.Errorf("log = %q", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the log directory, want 1", len(entries))
+	}
+}
+
+// newTestLogger 返回写入 buf 的 JSON 日志记录器
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(&contextHandler{Handler: slog.NewJSONHandler(buf, nil)})
+}
+
+// lastRecord 解析 buf 中最后一条 JSON 日志
+func lastRecord(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf)
+
+	run := With(context.Background(), "run_id", "abc", "job", "nightly")
+	task := With(run, "task", "备份数据库")
+	other := With(run, "task", "打包归档")
+
+	log.InfoContext(task, "🗄️ 开始", "size", 42)
+	got := lastRecord(t, &buf)
+	want := map[string]any{"run_id": "abc", "job": "nightly", "task": "备份数据库", "size": float64(42)}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	// 派生的 context 互不影响
+	log.InfoContext(other, "📦 开始")
+	if got := lastRecord(t, &buf); got["task"] != "打包归档" {
+		t.Errorf("task = %v, want 打包归档", got["task"])
+	}
+	log.InfoContext(run, "✅ 完成")
+	if got := lastRecord(t, &buf); got["task"] != nil || got["run_id"] != "abc" {
+		t.Errorf("record = %v, want run_id without task", got)
+	}
+
+	// WithAttrs 和 WithGroup 创建的记录器同样带上 context 中的属性
+	log.With("component", "daemon").WithGroup("detail").InfoContext(task, "⏰ 调度", "next", "12:00")
+	got = lastRecord(t, &buf)
+	if got["component"] != "daemon" {
+		t.Errorf("component = %v", got["component"])
+	}
+	detail, _ := got["detail"].(map[string]any)
+	if detail["next"] != "12:00" || detail["run_id"] != "abc" {
+		t.Errorf("detail = %v, want next and the context attributes", got["detail"])
+	}
+
+	log.Info("🚀 无 context 属性")
+	if got := lastRecord(t, &buf); got["run_id"] != nil {
+		t.Errorf("run_id = %v without a context", got["run_id"])
+	}
+}
+
+func TestReportLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf)
+
+	rep := report.New("nightly", "vault")
+	ctx := With(report.NewContext(context.Background(), rep), "run_id", rep.ID)
+	for i := 1; i <= 60; i++ {
+		log.InfoContext(ctx, "📝 进度", "n", i)
+	}
+	log.Info("🚀 不属于本次运行")
+
+	lines := rep.Snapshot().Log
+	if len(lines) != 50 {
+		t.Fatalf("report has %d log lines, want the last 50", len(lines))
+	}
+	if !strings.Contains(lines[0], "n=11") || !strings.Contains(lines[49], "n=60") {
+		t.Errorf("log = %q ... %q, want lines 11 to 60", lines[0], lines[49])
+	}
+	// 报告中的日志为文本格式，不重复 context 中的属性
+	if strings.Contains(lines[49], "run_id") || !strings.Contains(lines[49], "msg=") {
+		t.Errorf("report line = %q", lines[49])
+	}
+}
@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/scrub"
+)
+
+// Registry 按备份任务汇总运行结果，以 Prometheus 文本格式输出
+type Registry struct {
+	mu   sync.Mutex
+	jobs map[string]*jobMetrics
+}
+
+// jobMetrics 单个备份任务的指标
+type jobMetrics struct {
+	backupName   string
+	lastSuccess  time.Time
+	lastFailure  time.Time
+	lastDuration time.Duration
+	success      uint64
+	failure      uint64
+	tasks        map[string]time.Duration // 最近一次运行中各任务的耗时
+	archiveSize  int64                    // 以下为最近一次成功运行的结果
+	files        int64
+	bytes        int64
+	pruned       int
+	prunedTotal  uint64
+	diskFree     int64
+	lastScrub    time.Time
+	scrubbed     map[string]bool // 最近一次巡检中各归档是否完好，无法校验的归档不计入
+}
+
+// New 创建指标注册表
+func New() *Registry {
+	return &Registry{jobs: map[string]*jobMetrics{}}
+}
+
+// Observe 记录一次备份的运行报告
+func (r *Registry) Observe(cfg *config.Config, rep *report.Report) {
+	snap := rep.Snapshot()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := r.job(cfg)
+	m.lastDuration = snap.End.Sub(snap.Start)
+
+	m.tasks = make(map[string]time.Duration, len(snap.Tasks))
+	for _, t := range snap.Tasks {
+		m.tasks[t.Name] = t.Duration
+	}
+	if snap.DiskFree > 0 {
+		m.diskFree = snap.DiskFree
+	}
+	m.pruned = len(snap.Pruned)
+	m.prunedTotal += uint64(len(snap.Pruned))
+
+	if snap.Error != "" {
+		m.failure++
+		m.lastFailure = snap.End
+		return
+	}
+	m.success++
+	m.lastSuccess = snap.End
+	m.archiveSize = snap.ArchiveSize
+	m.files = snap.Files
+	m.bytes = snap.Bytes
+}
+
+// ObserveScrub 记录一次巡检中各归档的结果
+func (r *Registry) ObserveScrub(cfg *config.Config, rep *scrub.Report) {
+	snap := rep.Snapshot()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := r.job(cfg)
+	m.lastScrub = snap.End
+	m.scrubbed = make(map[string]bool, len(rep.Results))
+	for _, res := range rep.Results {
+		if res.Status != catalog.CheckError {
+			m.scrubbed[res.Archive] = res.Status == catalog.CheckOK
+		}
+	}
+}
+
+// job 返回任务的指标，没有时创建，调用方需持有 r.mu
+func (r *Registry) job(cfg *config.Config) *jobMetrics {
+	m, ok := r.jobs[cfg.Name]
+	if !ok {
+		m = &jobMetrics{}
+		r.jobs[cfg.Name] = m
+	}
+	m.backupName = cfg.BackupName
+	return m
+}
+
+// Retain 删除已不在配置中的任务的指标
+func (r *Registry) Retain(settings *config.Settings) {
+	keep := make(map[string]bool, len(settings.Jobs))
+	for _, cfg := range settings.Jobs {
+		keep[cfg.Name] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.jobs {
+		if !keep[name] {
+			delete(r.jobs, name)
+		}
+	}
+}
+
+// metric 一个指标的描述和取值方式
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(m *jobMetrics) (float64, bool)
+}
+
+var metricDefs = []metric{
+	{"vaultwarden_backup_last_success_timestamp_seconds", "gauge", "Unix time of the last successful backup.",
+		func(m *jobMetrics) (float64, bool) { return unix(m.lastSuccess) }},
+	{"vaultwarden_backup_last_failure_timestamp_seconds", "gauge", "Unix time of the last failed backup.",
+		func(m *jobMetrics) (float64, bool) { return unix(m.lastFailure) }},
+	{"vaultwarden_backup_last_duration_seconds", "gauge", "Duration of the last backup run.",
+		func(m *jobMetrics) (float64, bool) { return m.lastDuration.Seconds(), true }},
+	{"vaultwarden_backup_archive_size_bytes", "gauge", "Size of the last successful archive.",
+		func(m *jobMetrics) (float64, bool) { return float64(m.archiveSize), m.success > 0 }},
+	{"vaultwarden_backup_files", "gauge", "Number of files in the last successful archive.",
+		func(m *jobMetrics) (float64, bool) { return float64(m.files), m.success > 0 }},
+	{"vaultwarden_backup_copied_bytes", "gauge", "Bytes copied into the last successful archive before compression.",
+		func(m *jobMetrics) (float64, bool) { return float64(m.bytes), m.success > 0 }},
+	{"vaultwarden_backup_pruned_archives", "gauge", "Number of archives pruned by the last run.",
+		func(m *jobMetrics) (float64, bool) { return float64(m.pruned), true }},
+	{"vaultwarden_backup_pruned_archives_total", "counter", "Total number of archives pruned.",
+		func(m *jobMetrics) (float64, bool) { return float64(m.prunedTotal), true }},
+	{"vaultwarden_backup_disk_free_bytes", "gauge", "Free space on the backup filesystem at the last disk check.",
+		func(m *jobMetrics) (float64, bool) { return float64(m.diskFree), m.diskFree > 0 }},
+	{"vaultwarden_backup_scrub_last_timestamp_seconds", "gauge", "Unix time of the last completed scrub.",
+		func(m *jobMetrics) (float64, bool) { return unix(m.lastScrub) }},
+	{"vaultwarden_backup_scrub_corrupted_archives", "gauge", "Number of archives found corrupted by the last scrub.",
+		func(m *jobMetrics) (float64, bool) {
+			corrupted := 0
+			for _, ok := range m.scrubbed {
+				if !ok {
+					corrupted++
+				}
+			}
+			return float64(corrupted), !m.lastScrub.IsZero()
+		}},
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出所有指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// Write 以 Prometheus 文本格式写出所有指标
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.jobs))
+	for name := range r.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "# HELP vaultwarden_backup_runs_total Number of backup runs by result.\n")
+	fmt.Fprintf(w, "# TYPE vaultwarden_backup_runs_total counter\n")
+	for _, name := range names {
+		m := r.jobs[name]
+		fmt.Fprintf(w, "vaultwarden_backup_runs_total{%s,status=\"success\"} %d\n", labels(name, m), m.success)
+		fmt.Fprintf(w, "vaultwarden_backup_runs_total{%s,status=\"failure\"} %d\n", labels(name, m), m.failure)
+	}
+
+	for _, def := range metricDefs {
+		fmt.Fprintf(w, "# HELP %s %s\n", def.name, def.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", def.name, def.kind)
+		for _, name := range names {
+			m := r.jobs[name]
+			if v, ok := def.value(m); ok {
+				fmt.Fprintf(w, "%s{%s} %g\n", def.name, labels(name, m), v)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP vaultwarden_backup_scrub_archive_ok Whether each archive passed the last scrub (1) or is corrupted (0).\n")
+	fmt.Fprintf(w, "# TYPE vaultwarden_backup_scrub_archive_ok gauge\n")
+	for _, name := range names {
+		m := r.jobs[name]
+		archives := make([]string, 0, len(m.scrubbed))
+		for a := range m.scrubbed {
+			archives = append(archives, a)
+		}
+		sort.Strings(archives)
+		for _, a := range archives {
+			v := 0
+			if m.scrubbed[a] {
+				v = 1
+			}
+			fmt.Fprintf(w, "vaultwarden_backup_scrub_archive_ok{%s,archive=\"%s\"} %d\n", labels(name, m), escape(a), v)
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP vaultwarden_backup_task_duration_seconds Duration of each task in the last run.\n")
+	fmt.Fprintf(w, "# TYPE vaultwarden_backup_task_duration_seconds gauge\n")
+	for _, name := range names {
+		m := r.jobs[name]
+		tasks := make([]string, 0, len(m.tasks))
+		for t := range m.tasks {
+			tasks = append(tasks, t)
+		}
+		sort.Strings(tasks)
+		for _, t := range tasks {
+			fmt.Fprintf(w, "vaultwarden_backup_task_duration_seconds{%s,task=\"%s\"} %g\n", labels(name, m), escape(t), m.tasks[t].Seconds())
+		}
+	}
+}
+
+// labels 返回任务的公共标签
+func labels(job string, m *jobMetrics) string {
+	return fmt.Sprintf("backup_name=\"%s\",job=\"%s\"", escape(m.backupName), escape(job))
+}
+
+// escape 按 Prometheus 文本格式转义标签值
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func unix(t time.Time) (float64, bool) {
+	if t.IsZero() {
+		return 0, false
+	}
+	return float64(t.UnixNano()) / 1e9, true
+}
@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// StateFile 汇总状态文件名，保存在备份目录中，记录各汇总目标的周期开始时间和已累积的运行，重启后继续当前周期
+const StateFile = "digest.json"
+
+// digestCheckInterval 检查汇总是否到期的间隔
+const digestCheckInterval = time.Minute
+
+// pending 汇总目标在当前周期内累积的运行记录
+type pending struct {
+	Since time.Time   `json:"since"`
+	Runs  []digestRun `json:"runs"`
+}
+
+// digestRun 汇总需要的单次运行信息
+type digestRun struct {
+	Job         string    `json:"job"`
+	BackupName  string    `json:"backup_name"`
+	Status      string    `json:"status"`
+	End         time.Time `json:"end"`
+	Error       string    `json:"error,omitempty"`
+	Archive     string    `json:"archive,omitempty"`
+	ArchiveSize string    `json:"archive_size,omitempty"`
+	Pruned      int       `json:"pruned,omitempty"`
+}
+
+// newDigestRun 从通知消息中提取汇总需要的信息
+func newDigestRun(msg *Message) digestRun {
+	return digestRun{
+		Job:         msg.Job,
+		BackupName:  msg.BackupName,
+		Status:      msg.Status,
+		End:         msg.Report.End,
+		Error:       msg.Error,
+		Archive:     msg.Archive,
+		ArchiveSize: msg.ArchiveSize,
+		Pruned:      len(msg.Pruned),
+	}
+}
+
+// Digest 一段时间内各备份任务的运行汇总
+type Digest struct {
+	Since    time.Time
+	Until    time.Time
+	Runs     int
+	Failures int
+	Jobs     []*DigestJob
+}
+
+// DigestJob 单个备份任务在汇总周期内的情况
+type DigestJob struct {
+	Job         string
+	BackupName  string
+	Runs        int
+	Failures    int
+	LastStatus  string    // 最近一次运行的结果
+	LastSuccess time.Time // 周期内最近一次成功的时间，没有成功时为零值
+	Archive     string    // 最近一次成功的归档
+	ArchiveSize string
+	Pruned      int      // 周期内清理的旧备份数量
+	Errors      []string // 周期内的失败原因，按时间顺序，相同的只保留一条
+}
+
+// Title 返回汇总标题
+func (d *Digest) Title() string {
+	if d.Failures > 0 {
+		return "⚠️ Vaultwarden 备份汇总: " + d.Since.Format("2006-01-02") + " ~ " + d.Until.Format("2006-01-02")
+	}
+	return "📊 Vaultwarden 备份汇总: " + d.Since.Format("2006-01-02") + " ~ " + d.Until.Format("2006-01-02")
+}
+
+// newDigest 按任务汇总运行记录
+func newDigest(since, until time.Time, runs []digestRun) *Digest {
+	d := &Digest{Since: since, Until: until, Runs: len(runs)}
+	jobs := map[string]*DigestJob{}
+	for _, run := range runs {
+		j, ok := jobs[run.Job]
+		if !ok {
+			j = &DigestJob{Job: run.Job}
+			jobs[run.Job] = j
+			d.Jobs = append(d.Jobs, j)
+		}
+		j.BackupName = run.BackupName
+		j.Runs++
+		j.LastStatus = run.Status
+		j.Pruned += run.Pruned
+		if run.Status == StatusFailure {
+			d.Failures++
+			j.Failures++
+			if n := len(j.Errors); n == 0 || j.Errors[n-1] != run.Error {
+				j.Errors = append(j.Errors, run.Error)
+			}
+			continue
+		}
+		j.LastSuccess = run.End
+		j.Archive, j.ArchiveSize = run.Archive, run.ArchiveSize
+	}
+	sort.Slice(d.Jobs, func(i, k int) bool { return d.Jobs[i].Job < d.Jobs[k].Job })
+	return d
+}
+
+// Start 定期发送到期的汇总，不依赖备份是否运行；ctx 取消后停止
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(digestCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				d.flush(now)
+			}
+		}
+	}()
+}
+
+// flush 发送周期已满的汇总，周期内没有运行时也发送，以便发现备份已停止
+func (d *Dispatcher) flush(now time.Time) {
+	d.mu.Lock()
+	targets := d.targets
+	due := map[*Target]*Digest{}
+	for _, t := range targets {
+		if t.Digest == 0 {
+			continue
+		}
+		p := d.digests[t.key]
+		if now.Sub(p.Since) >= t.Digest {
+			due[t] = newDigest(p.Since, now, p.Runs)
+			p.Since, p.Runs = now, nil
+		}
+	}
+	if len(due) > 0 {
+		d.saveState()
+	}
+	d.mu.Unlock()
+
+	var sending []*Target
+	for _, t := range targets {
+		if _, ok := due[t]; ok {
+			sending = append(sending, t)
+		}
+	}
+	for i, err := range broadcast(sending, func(ctx context.Context, t *Target) error { return t.sendDigest(ctx, due[t]) }) {
+		t := sending[i]
+		if err != nil {
+			slog.Warn("⚠️ 发送汇总失败", "type", t.Type, "error", err)
+			continue
+		}
+		slog.Debug("📨 已发送汇总", "type", t.Type, "runs", due[t].Runs)
+	}
+}
+
+// loadState 读取汇总状态文件，文件不存在时返回空状态
+func loadState(file string) (map[string]*pending, error) {
+	state := map[string]*pending{}
+	if file == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return map[string]*pending{}, fmt.Errorf("无效的 %s: %w", filepath.Base(file), err)
+	}
+	for key, p := range state {
+		if p == nil {
+			delete(state, key)
+		}
+	}
+	return state, nil
+}
+
+// saveState 写入汇总状态文件，调用方需持有 d.mu；写入失败只记录日志
+func (d *Dispatcher) saveState() {
+	if d.stateFile == "" {
+		return
+	}
+	if err := writeState(d.stateFile, d.digests); err != nil {
+		slog.Warn("⚠️ 保存通知汇总状态失败", "file", d.stateFile, "error", err)
+	}
+}
+
+// writeState 先写临时文件再替换，避免中途退出留下不完整的文件
+func writeState(file string, state map[string]*pending) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
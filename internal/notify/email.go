@@ -0,0 +1,327 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/config"
+)
+
+// email 通过 SMTP 发送文本和 HTML 两种格式的报告
+type email struct {
+	host     string
+	port     int
+	tls      string // starttls、tls 或 none
+	username string
+	password string
+	from     *mail.Address
+	to       []*mail.Address
+	rootCAs  *x509.CertPool // 校验服务器证书的根证书，nil 时使用系统证书
+}
+
+// defaultPorts 各 tls 模式的默认端口
+var defaultPorts = map[string]int{"starttls": 587, "tls": 465, "none": 25}
+
+func newEmail(cfg config.Notify) (email, error) {
+	e := email{
+		host:     cfg.Host,
+		port:     cfg.Port,
+		tls:      cfg.TLS,
+		username: cfg.Username,
+		password: cfg.Password.Reveal(),
+	}
+	if e.host == "" {
+		return e, fmt.Errorf("email 需要 host")
+	}
+	if e.tls == "" {
+		e.tls = "starttls"
+	}
+	port, ok := defaultPorts[e.tls]
+	if !ok {
+		return e, fmt.Errorf("无效的 tls: %s，可选 starttls、tls、none", e.tls)
+	}
+	if e.port == 0 {
+		e.port = port
+	}
+
+	if cfg.From == "" {
+		return e, fmt.Errorf("email 需要 from")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return e, fmt.Errorf("无效的 from: %w", err)
+	}
+	e.from = from
+
+	if len(cfg.To) == 0 {
+		return e, fmt.Errorf("email 需要 to")
+	}
+	for _, addr := range cfg.To {
+		to, err := mail.ParseAddress(addr)
+		if err != nil {
+			return e, fmt.Errorf("无效的 to %s: %w", addr, err)
+		}
+		e.to = append(e.to, to)
+	}
+	return e, nil
+}
+
+func (e email) Send(ctx context.Context, msg *Message, text string) error {
+	var html bytes.Buffer
+	if err := emailTemplate.Execute(&html, msg); err != nil {
+		return fmt.Errorf("渲染邮件失败: %w", err)
+	}
+	return e.deliver(ctx, msg.Title(), text, html.String())
+}
+
+func (e email) SendDigest(ctx context.Context, d *Digest) error {
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, d); err != nil {
+		return fmt.Errorf("渲染邮件失败: %w", err)
+	}
+	if err := digestTemplate.Execute(&html, d); err != nil {
+		return fmt.Errorf("渲染邮件失败: %w", err)
+	}
+	return e.deliver(ctx, d.Title(), strings.TrimSpace(text.String()), html.String())
+}
+
+// deliver 连接 SMTP 服务器并发送邮件
+func (e email) deliver(ctx context.Context, subject, text, html string) error {
+	body, err := e.compose(subject, text, html)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	tlsConfig := &tls.Config{ServerName: e.host, RootCAs: e.rootCAs}
+	var conn net.Conn
+	if e.tls == "tls" {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	defer c.Close()
+
+	if e.tls == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS 失败: %w", err)
+		}
+	}
+	if e.username != "" {
+		// PlainAuth 只允许在 TLS 连接或 localhost 上发送密码
+		if err := c.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+
+	if err := c.Mail(e.from.Address); err != nil {
+		return fmt.Errorf("发件人被拒绝: %w", err)
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %w", to.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return c.Quit()
+}
+
+// compose 生成 multipart/alternative 邮件
+func (e email) compose(subject, text, html string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(strings.ReplaceAll(part.content, "\n", "\r\n"))); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	to := make([]string, len(e.to))
+	for i, addr := range e.to {
+		to[i] = addr.String()
+	}
+	var msg bytes.Buffer
+	header := [][2]string{
+		{"From", e.from.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(e.from.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	for _, h := range header {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// messageID 生成 Message-ID，域名取自发件人地址
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%x@%s>", time.Now().Unix(), b, domain)
+}
+
+// emailStyle 邮件的公共样式
+const emailStyle = `<style>
+body{font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#222}
+table{border-collapse:collapse;margin:8px 0 16px}
+th,td{border:1px solid #ddd;padding:4px 10px;text-align:left;font-size:14px}
+th{background:#f5f5f5}
+.failure{color:#c0392b}
+.success{color:#27ae60}
+</style>`
+
+var templateFuncs = htmltemplate.FuncMap{
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04")
+	},
+}
+
+// emailTemplate 单次运行报告的 HTML 正文
+var emailTemplate = htmltemplate.Must(htmltemplate.New("email").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8">` + emailStyle + `</head><body>
+<h2 class="{{if eq .Status "failure"}}failure{{else}}success{{end}}">{{.Title}}</h2>
+<table>
+<tr><th>任务</th><td>{{.Job}}</td></tr>
+<tr><th>备份名称</th><td>{{.BackupName}}</td></tr>
+<tr><th>开始时间</th><td>{{datetime .Report.Start}}</td></tr>
+<tr><th>耗时</th><td>{{.Duration}}</td></tr>
+{{- if .Archive}}
+<tr><th>归档</th><td>{{.Archive}}</td></tr>
+<tr><th>大小</th><td>{{.ArchiveSize}}{{if .SizeChange}}（较上次 {{.SizeChange}}）{{end}}</td></tr>
+<tr><th>文件数</th><td>{{.Report.Files}}</td></tr>
+{{- end}}
+{{- if .Error}}
+<tr><th>错误</th><td class="failure">{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- if .Tasks}}
+<h3>任务</h3>
+<table>
+<tr><th>名称</th><th>耗时</th><th>结果</th></tr>
+{{- range .Tasks}}
+<tr><td>{{.Name}}</td><td>{{.Duration}}</td>{{if .Error}}<td class="failure">❌ {{.Error}}</td>{{else}}<td class="success">✅</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Pruned}}
+<h3>已清理的旧备份</h3>
+<ul>
+{{- range .Pruned}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+<p style="color:#888;font-size:12px">运行 ID: {{.Report.ID}}</p>
+</body></html>
+`))
+
+// digestTemplate 汇总的 HTML 正文
+var digestTemplate = htmltemplate.Must(htmltemplate.New("digest").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8">` + emailStyle + `</head><body>
+<h2 class="{{if .Failures}}failure{{else}}success{{end}}">{{.Title}}</h2>
+<p>共运行 {{.Runs}} 次，失败 {{.Failures}} 次。</p>
+<table>
+<tr><th>任务</th><th>备份名称</th><th>运行</th><th>失败</th><th>最近成功</th><th>最新归档</th><th>清理</th></tr>
+{{- range .Jobs}}
+<tr><td>{{.Job}}</td><td>{{.BackupName}}</td><td>{{.Runs}}</td><td{{if .Failures}} class="failure"{{end}}>{{.Failures}}</td><td>{{datetime .LastSuccess}}</td><td>{{if .Archive}}{{.Archive}} ({{.ArchiveSize}}){{else}}-{{end}}</td><td>{{.Pruned}}</td></tr>
+{{- end}}
+</table>
+{{- range .Jobs}}
+{{- if .Errors}}
+<h3 class="failure">{{.Job}} 的失败原因</h3>
+<ul>
+{{- range .Errors}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- end}}
+</body></html>
+`))
+
+// digestTextTemplate 汇总的纯文本正文
+var digestTextTemplate = template.Must(template.New("digest").Funcs(template.FuncMap(templateFuncs)).Parse(`{{.Title}}
+共运行 {{.Runs}} 次，失败 {{.Failures}} 次
+{{range .Jobs}}
+{{.Job}} ({{.BackupName}})
+  运行: {{.Runs}}，失败: {{.Failures}}
+  最近成功: {{datetime .LastSuccess}}
+{{- if .Archive}}
+  最新归档: {{.Archive}} ({{.ArchiveSize}})
+{{- end}}
+{{- if .Pruned}}
+  清理: {{.Pruned}} 个旧备份
+{{- end}}
+{{- range .Errors}}
+  错误: {{.}}
+{{- end}}
+{{end}}`))
@@ -0,0 +1,468 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+)
+
+// received 测试 SMTP 服务器收到的一封邮件
+type received struct {
+	TLS  bool   // 发送 DATA 时连接是否已加密
+	Auth string // AUTH PLAIN 中的用户名
+	From string
+	To   []string
+	Data []byte
+}
+
+// smtpServer 只实现发送邮件所需命令的 SMTP 服务器
+type smtpServer struct {
+	addr     string
+	tls      *tls.Config
+	starttls bool // 是否提供 STARTTLS
+	mail     chan received
+}
+
+// newSMTPServer 启动 SMTP 服务器；mode 为 tls 时使用隐式 TLS，starttls 时提供 STARTTLS 扩展
+func newSMTPServer(t *testing.T, mode string) (*smtpServer, *x509.CertPool) {
+	t.Helper()
+	cert, pool := testCertificate(t)
+	s := &smtpServer{
+		tls:      &tls.Config{Certificates: []tls.Certificate{cert}},
+		starttls: mode == "starttls",
+		mail:     make(chan received, 10),
+	}
+
+	var ln net.Listener
+	var err error
+	if mode == "tls" {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", s.tls)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s.addr = ln.Addr().String()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, mode == "tls")
+		}
+	}()
+	return s, pool
+}
+
+func (s *smtpServer) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	r := textproto.NewReader(bufio.NewReader(conn))
+	w := textproto.NewWriter(bufio.NewWriter(conn))
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			w.W.WriteString(line + "\r\n")
+		}
+		w.W.Flush()
+	}
+
+	var msg received
+	reply("220 test ESMTP")
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			lines := []string{"250-test"}
+			if s.starttls && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			reply(append(lines, "250 AUTH PLAIN")...)
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			r = textproto.NewReader(bufio.NewReader(conn))
+			w = textproto.NewWriter(bufio.NewWriter(conn))
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			if parts := strings.Split(string(decoded), "\x00"); len(parts) == 3 {
+				msg.Auth = parts[1]
+			}
+			reply("235 ok")
+		case "MAIL":
+			msg.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			msg.To = append(msg.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := r.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.TLS, msg.Data = secure, data
+			s.mail <- msg
+			msg = received{}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unsupported")
+		}
+	}
+}
+
+// next 等待下一封邮件
+func (s *smtpServer) next(t *testing.T) received {
+	t.Helper()
+	select {
+	case msg := <-s.mail:
+		return msg
+	case <-time.After(10 * time.Second):
+		t.Fatal("no mail received")
+		return received{}
+	}
+}
+
+// testCertificate 生成 127.0.0.1 的自签名证书
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// emailTarget 创建发往测试服务器的 email 目标
+func emailTarget(t *testing.T, s *smtpServer, pool *x509.CertPool, cfg config.Notify) *Target {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(s.addr)
+	cfg.Type = "email"
+	cfg.Host = host
+	cfg.Port, _ = strconv.Atoi(port)
+	if cfg.From == "" {
+		cfg.From = "Vaultwarden Backup <backup@example.com>"
+	}
+	if len(cfg.To) == 0 {
+		cfg.To = []string{"admin@example.com"}
+	}
+	target, err := newTarget(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := target.sender.(email)
+	e.rootCAs = pool
+	target.sender = e
+	return target
+}
+
+// parsedMail 解析后的 multipart/alternative 邮件
+type parsedMail struct {
+	Subject string
+	Header  mail.Header
+	Text    string
+	HTML    string
+}
+
+func parseMail(t *testing.T, data []byte) parsedMail {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+
+	parsed := parsedMail{Subject: subject, Header: msg.Header}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// multipart.Reader 已解码 quoted-printable
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch part.Header.Get("Content-Type") {
+		case "text/plain; charset=utf-8":
+			parsed.Text = string(body)
+		case "text/html; charset=utf-8":
+			parsed.HTML = string(body)
+		default:
+			t.Errorf("unexpected part %q", part.Header.Get("Content-Type"))
+		}
+	}
+	return parsed
+}
+
+func TestEmailMultipart(t *testing.T) {
+	s, pool := newSMTPServer(t, "none")
+	target := emailTarget(t, s, pool, config.Notify{TLS: "none", To: []string{"a@example.com", "B <b@example.com>"}})
+
+	if err := target.Send(testMessage(t, StatusFailure, errors.New("disk <full>"))); err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.next(t)
+	if got.TLS || got.Auth != "" {
+		t.Errorf("tls = %v, auth = %q, want plain connection without auth", got.TLS, got.Auth)
+	}
+	if got.From != "backup@example.com" || strings.Join(got.To, ",") != "a@example.com,b@example.com" {
+		t.Errorf("envelope = %s -> %v", got.From, got.To)
+	}
+
+	m := parseMail(t, got.Data)
+	if m.Subject != "🚨 Vaultwarden 备份失败: vault" {
+		t.Errorf("subject = %q", m.Subject)
+	}
+	if to := m.Header.Get("To"); !strings.Contains(to, "a@example.com") || !strings.Contains(to, "b@example.com") {
+		t.Errorf("To = %q", to)
+	}
+	if !strings.HasSuffix(m.Header.Get("Message-Id"), "@example.com>") {
+		t.Errorf("Message-ID = %q", m.Header.Get("Message-Id"))
+	}
+	if !strings.Contains(m.Text, "错误: disk <full>") {
+		t.Errorf("text part = %q", m.Text)
+	}
+	if !strings.Contains(m.HTML, `<h2 class="failure">`) || !strings.Contains(m.HTML, "disk &lt;full&gt;") {
+		t.Errorf("html part = %q", m.HTML)
+	}
+}
+
+func TestEmailTLSModes(t *testing.T) {
+	for _, mode := range []string{"starttls", "tls"} {
+		t.Run(mode, func(t *testing.T) {
+			s, pool := newSMTPServer(t, mode)
+			target := emailTarget(t, s, pool, config.Notify{TLS: mode, Username: "backup", Password: secret.Value("smtp-pass")})
+
+			if err := target.Send(testMessage(t, StatusSuccess, nil)); err != nil {
+				t.Fatal(err)
+			}
+			got := s.next(t)
+			if !got.TLS {
+				t.Error("mail was sent over an unencrypted connection")
+			}
+			if got.Auth != "backup" {
+				t.Errorf("auth user = %q", got.Auth)
+			}
+		})
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	s, pool := newSMTPServer(t, "none")
+	target := emailTarget(t, s, pool, config.Notify{TLS: "starttls"})
+
+	err := target.Send(testMessage(t, StatusSuccess, nil))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("err = %v, want missing STARTTLS", err)
+	}
+}
+
+func TestEmailUntrustedCertificate(t *testing.T) {
+	s, _ := newSMTPServer(t, "tls")
+	target := emailTarget(t, s, nil, config.Notify{TLS: "tls"})
+
+	if err := target.Send(testMessage(t, StatusSuccess, nil)); err == nil {
+		t.Fatal("sent mail to a server with an untrusted certificate")
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	s, pool := newSMTPServer(t, "none")
+	target := emailTarget(t, s, pool, config.Notify{TLS: "none", On: "never", Digest: "weekly"})
+	d := NewDispatcher([]*Target{target}, "")
+
+	cfg := testConfig(t)
+	d.Observe(cfg, finished(nil))
+	d.Observe(cfg, finished(errors.New("disk full")))
+	d.Observe(cfg, finished(errors.New("disk full")))
+	other := testConfig(t)
+	other.Name, other.BackupName = "other", "ot"
+	d.Observe(other, finished(nil))
+
+	since := d.digests[target.key].Since
+	d.flush(since.Add(6 * 24 * time.Hour))
+	select {
+	case <-s.mail:
+		t.Fatal("digest sent before the period ended")
+	default:
+	}
+
+	d.flush(since.Add(7 * 24 * time.Hour))
+	m := parseMail(t, s.next(t).Data)
+	if !strings.HasPrefix(m.Subject, "⚠️ Vaultwarden 备份汇总: ") {
+		t.Errorf("subject = %q", m.Subject)
+	}
+	for _, want := range []string{"共运行 4 次，失败 2 次", "vault (vw)", "运行: 3，失败: 2", "错误: disk full", "other (ot)"} {
+		if !strings.Contains(m.Text, want) {
+			t.Errorf("text part lacks %q:\n%s", want, m.Text)
+		}
+	}
+	if strings.Count(m.Text, "错误: disk full") != 1 {
+		t.Errorf("repeated errors are not collapsed:\n%s", m.Text)
+	}
+
+	// 下一个周期内没有运行时也发送
+	d.flush(since.Add(14 * 24 * time.Hour))
+	m = parseMail(t, s.next(t).Data)
+	if !strings.HasPrefix(m.Subject, "📊 ") || !strings.Contains(m.Text, "共运行 0 次") {
+		t.Errorf("empty digest = %q:\n%s", m.Subject, m.Text)
+	}
+}
+
+func TestDigestStateSurvivesRestart(t *testing.T) {
+	s, pool := newSMTPServer(t, "none")
+	state := filepath.Join(t.TempDir(), StateFile)
+	cfg := config.Notify{TLS: "none", On: "never", Digest: "daily"}
+
+	d := NewDispatcher([]*Target{emailTarget(t, s, pool, cfg)}, state)
+	d.Observe(testConfig(t), finished(errors.New("disk full")))
+	d.Observe(testConfig(t), finished(nil))
+	var since time.Time
+	for _, p := range d.digests {
+		since = p.Since
+	}
+
+	// 重启后使用保存的周期开始时间和运行记录
+	restarted := NewDispatcher([]*Target{emailTarget(t, s, pool, cfg)}, state)
+	for _, p := range restarted.digests {
+		if !p.Since.Equal(since) || len(p.Runs) != 2 {
+			t.Fatalf("restored state = %v with %d runs, want %v with 2", p.Since, len(p.Runs), since)
+		}
+	}
+
+	restarted.flush(since.Add(24 * time.Hour))
+	m := parseMail(t, s.next(t).Data)
+	if !strings.Contains(m.Text, "共运行 2 次，失败 1 次") {
+		t.Errorf("digest after restart:\n%s", m.Text)
+	}
+
+	// 发送后新周期从发送时间开始，也会保存
+	again := NewDispatcher([]*Target{emailTarget(t, s, pool, cfg)}, state)
+	for _, p := range again.digests {
+		if !p.Since.Equal(since.Add(24*time.Hour)) || len(p.Runs) != 0 {
+			t.Errorf("state after digest = %v with %d runs", p.Since, len(p.Runs))
+		}
+	}
+}
+
+func TestDigestStateFileChanged(t *testing.T) {
+	s, pool := newSMTPServer(t, "none")
+	cfg := config.Notify{TLS: "none", On: "never", Digest: "daily"}
+	oldState := filepath.Join(t.TempDir(), StateFile)
+	newState := filepath.Join(t.TempDir(), StateFile)
+
+	d := NewDispatcher([]*Target{emailTarget(t, s, pool, cfg)}, oldState)
+	d.Observe(testConfig(t), finished(nil))
+
+	// 重新加载后备份目录改变，已累积的运行继续计入当前周期并保存到新文件
+	d.SetTargets([]*Target{emailTarget(t, s, pool, cfg)}, newState, nil)
+	d.Observe(testConfig(t), finished(errors.New("disk full")))
+
+	restarted := NewDispatcher([]*Target{emailTarget(t, s, pool, cfg)}, newState)
+	if len(restarted.digests) != 1 {
+		t.Fatalf("restored %d digests from the new state file, want 1", len(restarted.digests))
+	}
+	for _, p := range restarted.digests {
+		if len(p.Runs) != 2 {
+			t.Errorf("restored %d runs, want 2", len(p.Runs))
+		}
+	}
+
+	old, err := loadState(oldState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range old {
+		if len(p.Runs) != 1 {
+			t.Errorf("old state file has %d runs, want it left at 1", len(p.Runs))
+		}
+	}
+}
+
+func TestDigestStateInvalidFile(t *testing.T) {
+	state := filepath.Join(t.TempDir(), StateFile)
+	if err := writeState(state, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(state); err != nil {
+		t.Fatalf("loadState(null) = %v", err)
+	}
+
+	if err := os.WriteFile(state, []byte("{broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	digests, err := loadState(state)
+	if err == nil || len(digests) != 0 {
+		t.Errorf("loadState(invalid) = %v, %v", digests, err)
+	}
+}
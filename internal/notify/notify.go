@@ -0,0 +1,395 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/scrub"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+)
+
+// 运行结果
+const (
+	StatusSuccess  = "success"
+	StatusFailure  = "failure"
+	StatusRecovery = "recovery" // 上一次失败后的首次成功
+)
+
+// sendTimeout 一次通知的发送超时，各目标并行发送、共用这一截止时间。
+// 需小于服务关闭时等待备份完成的 10 秒，关闭前结束的备份仍能发出通知
+const sendTimeout = 8 * time.Second
+
+// Message 通知模板可用的数据
+type Message struct {
+	Status      string              // success、failure 或 recovery
+	Job         string              // 任务名称
+	BackupName  string              // BACKUP_NAME
+	Duration    time.Duration       // 运行时长
+	Archive     string              // 归档文件名
+	ArchiveSize string              // 归档大小，如 12.3 MB
+	SizeChange  string              // 与上一个归档相比的大小变化，如 +1.2 KB (+0.8%)，没有上一个归档时为空
+	Error       string              // 失败原因
+	Tasks       []report.TaskResult // 各任务的耗时（精确到毫秒）和错误
+	Pruned      []string            // 本次清理掉的旧归档文件名
+	Report      *report.Report      // 完整的运行报告
+	Scrub       bool                // 定期巡检的结果，Tasks 为各归档的校验结果
+}
+
+// Title 返回消息标题
+func (m *Message) Title() string {
+	if m.Scrub {
+		if m.Status == StatusFailure {
+			return "🚨 Vaultwarden 备份巡检发现损坏: " + m.Job
+		}
+		return "✅ Vaultwarden 备份巡检通过: " + m.Job
+	}
+	switch m.Status {
+	case StatusFailure:
+		return "🚨 Vaultwarden 备份失败: " + m.Job
+	case StatusRecovery:
+		return "✅ Vaultwarden 备份已恢复: " + m.Job
+	default:
+		return "✅ Vaultwarden 备份成功: " + m.Job
+	}
+}
+
+// defaultTemplate 内置消息模板
+const defaultTemplate = `{{.Title}}
+备份名称: {{.BackupName}}
+耗时: {{.Duration}}
+{{- if .Archive}}
+归档: {{.Archive}} ({{.ArchiveSize}}{{if .SizeChange}}，较上次 {{.SizeChange}}{{end}})
+{{- end}}
+{{- if .Pruned}}
+清理: {{len .Pruned}} 个旧备份
+{{- end}}
+{{- if .Error}}
+错误: {{.Error}}
+{{- end}}
+{{- if .Tasks}}
+
+任务:
+{{- range .Tasks}}
+- {{.Name}}: {{.Duration}}{{if .Error}} ❌{{end}}
+{{- end}}
+{{- end}}
+`
+
+// Sender 将渲染好的消息发送到具体的服务
+type Sender interface {
+	Send(ctx context.Context, msg *Message, text string) error
+}
+
+// digestSender 支持定期汇总的发送方式
+type digestSender interface {
+	SendDigest(ctx context.Context, d *Digest) error
+}
+
+// digestPeriods digest 的可选值
+var digestPeriods = map[string]time.Duration{"daily": 24 * time.Hour, "weekly": 7 * 24 * time.Hour}
+
+// Target 一个通知目标：发送方式、触发条件和消息模板
+type Target struct {
+	Type     string
+	On       string
+	Digest   time.Duration // 汇总周期，0 表示不汇总
+	key      string        // 重新加载配置时用于保留汇总中已累积的记录
+	sender   Sender
+	template *template.Template
+}
+
+// NewTargets 根据配置创建通知目标，配置或模板无效时返回错误
+func NewTargets(cfgs []config.Notify) ([]*Target, error) {
+	targets := make([]*Target, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		t, err := newTarget(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("notify[%d] (%s): %w", i, cfg.Type, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func newTarget(cfg config.Notify) (*Target, error) {
+	sender, err := newSender(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	text := cfg.Template
+	if text == "" {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New(cfg.Type).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("无效的模板: %w", err)
+	}
+
+	on := cfg.On
+	if on == "" {
+		on = "failure"
+	}
+
+	t := &Target{Type: cfg.Type, On: on, sender: sender, template: tmpl}
+	if cfg.Digest != "" {
+		period, ok := digestPeriods[cfg.Digest]
+		if !ok {
+			return nil, fmt.Errorf("无效的 digest: %s，可选 daily、weekly", cfg.Digest)
+		}
+		if _, ok := sender.(digestSender); !ok {
+			return nil, fmt.Errorf("%s 不支持 digest", cfg.Type)
+		}
+		t.Digest = period
+		t.key = cfg.Type + ":" + cfg.Digest + ":" + strings.Join(cfg.To, ",")
+	}
+	return t, nil
+}
+
+// wants 判断该目标是否需要通知此状态
+func (t *Target) wants(status string) bool {
+	switch t.On {
+	case "always":
+		return true
+	case "recovery":
+		return status == StatusFailure || status == StatusRecovery
+	case "never":
+		return false
+	default:
+		return status == StatusFailure
+	}
+}
+
+// Dispatcher 在每次备份后向所有通知目标发送消息，并记录各任务上一次的结果用于判断恢复
+type Dispatcher struct {
+	mu        sync.Mutex
+	targets   []*Target
+	failed    map[string]bool     // 任务上一次是否失败
+	digests   map[string]*pending // 各汇总目标尚未发送的记录
+	stateFile string              // 汇总状态文件，为空时只保存在内存中
+}
+
+// NewDispatcher 创建通知分发器。stateFile 保存汇总的周期开始时间和已累积的运行，
+// 读取失败时从当前时间重新开始周期
+func NewDispatcher(targets []*Target, stateFile string) *Dispatcher {
+	digests, err := loadState(stateFile)
+	if err != nil {
+		slog.Warn("⚠️ 读取通知汇总状态失败，重新开始汇总周期", "file", stateFile, "error", err)
+	}
+	d := &Dispatcher{failed: map[string]bool{}, digests: digests}
+	d.SetTargets(targets, stateFile, nil)
+	return d
+}
+
+// SetTargets 替换通知目标和汇总状态文件，保留 jobs 中各任务的历史状态和汇总中已累积的记录，
+// 已不在配置中的任务的状态被删除。状态文件改变时（如备份目录已修改）当前周期继续，之后保存到新文件
+func (d *Dispatcher) SetTargets(targets []*Target, stateFile string, jobs []*config.Config) {
+	keep := make(map[string]bool, len(jobs))
+	for _, cfg := range jobs {
+		keep[cfg.Name] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.targets = targets
+	d.stateFile = stateFile
+	for name := range d.failed {
+		if !keep[name] {
+			delete(d.failed, name)
+		}
+	}
+
+	digests := make(map[string]*pending, len(targets))
+	for _, t := range targets {
+		if t.Digest == 0 {
+			continue
+		}
+		p, ok := d.digests[t.key]
+		if !ok {
+			p = &pending{Since: time.Now()}
+		}
+		digests[t.key] = p
+	}
+	d.digests = digests
+	d.saveState()
+}
+
+// Observe 根据运行报告发送通知，发送失败只记录日志，不影响备份结果
+func (d *Dispatcher) Observe(cfg *config.Config, rep *report.Report) {
+	snap := rep.Snapshot()
+
+	d.mu.Lock()
+	targets := d.targets
+	status := StatusSuccess
+	switch {
+	case snap.Error != "":
+		status = StatusFailure
+	case d.failed[cfg.Name]:
+		status = StatusRecovery
+	}
+	d.failed[cfg.Name] = snap.Error != ""
+
+	msg := NewMessage(cfg, snap, status)
+	if len(d.digests) > 0 {
+		run := newDigestRun(msg)
+		for _, p := range d.digests {
+			p.Runs = append(p.Runs, run)
+		}
+		d.saveState()
+	}
+	d.mu.Unlock()
+
+	wanted := wanting(targets, status)
+	for i, err := range broadcast(wanted, func(ctx context.Context, t *Target) error { return t.send(ctx, msg) }) {
+		if err != nil {
+			slog.Warn("⚠️ 发送通知失败", "job", cfg.Name, "type", wanted[i].Type, "error", err)
+			continue
+		}
+		slog.Debug("📨 已发送通知", "job", cfg.Name, "type", wanted[i].Type, "status", status)
+	}
+}
+
+// ObserveScrub 巡检发现损坏的归档时按失败通知，否则只通知 on 为 always 的目标；巡检结果不计入汇总
+func (d *Dispatcher) ObserveScrub(cfg *config.Config, rep *scrub.Report) {
+	snap := rep.Snapshot()
+
+	d.mu.Lock()
+	targets := d.targets
+	d.mu.Unlock()
+
+	status := StatusSuccess
+	if snap.Error != "" {
+		status = StatusFailure
+	}
+	msg := NewMessage(cfg, snap, status)
+	msg.Scrub = true
+
+	wanted := wanting(targets, status)
+	for i, err := range broadcast(wanted, func(ctx context.Context, t *Target) error { return t.send(ctx, msg) }) {
+		if err != nil {
+			slog.Warn("⚠️ 发送通知失败", "job", cfg.Name, "type", wanted[i].Type, "error", err)
+			continue
+		}
+		slog.Debug("📨 已发送巡检通知", "job", cfg.Name, "type", wanted[i].Type, "status", status)
+	}
+}
+
+// wanting 返回需要通知此状态的目标
+func wanting(targets []*Target, status string) []*Target {
+	var wanted []*Target
+	for _, t := range targets {
+		if t.wants(status) {
+			wanted = append(wanted, t)
+		}
+	}
+	return wanted
+}
+
+// broadcast 并行向各目标发送，所有目标共用 sendTimeout 的截止时间，一个目标无响应不会拖延其他目标；
+// 返回与 targets 一一对应的错误
+func broadcast(targets []*Target, send func(ctx context.Context, t *Target) error) []error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = send(ctx, t)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// Send 渲染模板并发送
+func (t *Target) Send(msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return t.send(ctx, msg)
+}
+
+func (t *Target) send(ctx context.Context, msg *Message) error {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, msg); err != nil {
+		return fmt.Errorf("渲染模板失败: %w", err)
+	}
+	return t.sender.Send(ctx, msg, strings.TrimSpace(buf.String()))
+}
+
+// SendDigest 发送一段时间内的汇总
+func (t *Target) SendDigest(d *Digest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return t.sendDigest(ctx, d)
+}
+
+func (t *Target) sendDigest(ctx context.Context, d *Digest) error {
+	return t.sender.(digestSender).SendDigest(ctx, d)
+}
+
+// NewMessage 根据运行报告生成模板数据
+func NewMessage(cfg *config.Config, rep *report.Report, status string) *Message {
+	msg := &Message{
+		Status:     status,
+		Job:        cfg.Name,
+		BackupName: cfg.BackupName,
+		Duration:   rep.End.Sub(rep.Start).Round(time.Millisecond),
+		Error:      rep.Error,
+		Report:     rep,
+	}
+	for _, t := range rep.Tasks {
+		t.Duration = t.Duration.Round(time.Millisecond)
+		msg.Tasks = append(msg.Tasks, t)
+	}
+	for _, p := range rep.Pruned {
+		msg.Pruned = append(msg.Pruned, filepath.Base(p))
+	}
+	if rep.Archive != "" {
+		msg.Archive = filepath.Base(rep.Archive)
+		msg.ArchiveSize = utils.FormatBytes(rep.ArchiveSize)
+		if prev, ok := previousArchive(cfg, rep.Archive); ok {
+			msg.SizeChange = sizeChange(prev.Size, rep.ArchiveSize)
+		}
+	}
+	return msg
+}
+
+// previousArchive 返回 current 之前的最新归档
+func previousArchive(cfg *config.Config, current string) (archive.Entry, bool) {
+	entries, err := archive.List(cfg.BackupDir, cfg.BackupName)
+	if err != nil {
+		return archive.Entry{}, false
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Path != current {
+			return entries[i], true
+		}
+	}
+	return archive.Entry{}, false
+}
+
+// sizeChange 格式化大小变化，如 +1.2 KB (+0.8%)
+func sizeChange(prev, cur int64) string {
+	diff := cur - prev
+	sign := "+"
+	if diff < 0 {
+		sign, diff = "-", -diff
+	}
+	if prev == 0 {
+		return sign + utils.FormatBytes(diff)
+	}
+	return fmt.Sprintf("%s%s (%+.1f%%)", sign, utils.FormatBytes(diff), float64(cur-prev)/float64(prev)*100)
+}
@@ -0,0 +1,182 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+)
+
+// finished 返回一份已结束的运行报告，err 非 nil 时为失败
+func finished(err error) *report.Report {
+	rep := report.New("vault", "vw")
+	rep.Finish(err)
+	return rep
+}
+
+func TestDispatcherModes(t *testing.T) {
+	recorders := map[string]*recorder{}
+	var cfgs []config.Notify
+	for _, on := range []string{"", "failure", "always", "recovery", "never"} {
+		rec := newRecorder(t)
+		recorders[on] = rec
+		cfgs = append(cfgs, config.Notify{Type: "webhook", URL: secret.Value(rec.URL), On: on})
+	}
+	targets, err := NewTargets(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(targets, "")
+
+	cfg := testConfig(t)
+	for _, err := range []error{nil, errors.New("disk full"), errors.New("disk full"), nil, nil} {
+		d.Observe(cfg, finished(err))
+	}
+
+	want := map[string][]string{
+		"":         {StatusFailure, StatusFailure},
+		"failure":  {StatusFailure, StatusFailure},
+		"always":   {StatusSuccess, StatusFailure, StatusFailure, StatusRecovery, StatusSuccess},
+		"recovery": {StatusFailure, StatusFailure, StatusRecovery},
+		"never":    nil,
+	}
+	for on, statuses := range want {
+		reqs := recorders[on].Requests()
+		if len(reqs) != len(statuses) {
+			t.Errorf("on %q: received %d notifications, want %d", on, len(reqs), len(statuses))
+			continue
+		}
+		for i, req := range reqs {
+			if got := req.JSON(t)["status"]; got != statuses[i] {
+				t.Errorf("on %q: notification %d status = %v, want %s", on, i, got, statuses[i])
+			}
+		}
+	}
+}
+
+func TestDispatcherRecoveryPerJob(t *testing.T) {
+	rec := newRecorder(t)
+	targets, err := NewTargets([]config.Notify{{Type: "webhook", URL: secret.Value(rec.URL), On: "always"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(targets, "")
+
+	vault, other := testConfig(t), testConfig(t)
+	other.Name = "other"
+	d.Observe(vault, finished(errors.New("disk full")))
+	d.Observe(other, finished(nil))
+	d.Observe(vault, finished(nil))
+
+	var statuses []any
+	for _, req := range rec.Requests() {
+		statuses = append(statuses, req.JSON(t)["status"])
+	}
+	if len(statuses) != 3 || statuses[1] != StatusSuccess || statuses[2] != StatusRecovery {
+		t.Errorf("statuses = %v, want failure, success, recovery", statuses)
+	}
+}
+
+func TestDispatcherSendFailureDoesNotStopOtherTargets(t *testing.T) {
+	broken, ok := newRecorder(t), newRecorder(t)
+	broken.status = 500
+	targets, err := NewTargets([]config.Notify{
+		{Type: "slack", URL: secret.Value(broken.URL)},
+		{Type: "slack", URL: secret.Value(ok.URL)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	NewDispatcher(targets, "").Observe(testConfig(t), finished(errors.New("disk full")))
+	if len(broken.Requests()) != 1 || len(ok.Requests()) != 1 {
+		t.Errorf("requests = %d, %d, want 1 each", len(broken.Requests()), len(ok.Requests()))
+	}
+}
+
+func TestNewTargetsInvalid(t *testing.T) {
+	for _, cfg := range []config.Notify{
+		{Type: "webhook"},
+		{Type: "telegram", Token: "t"},
+		{Type: "gotify", URL: "http://gotify"},
+		{Type: "pager", URL: "http://x"},
+		{Type: "slack", URL: "http://x", Template: "{{.Job"},
+		{Type: "slack", URL: "http://x", Digest: "weekly"},
+	} {
+		if _, err := NewTargets([]config.Notify{cfg}); err == nil {
+			t.Errorf("NewTargets(%+v) succeeded", cfg)
+		}
+	}
+}
+
+// barrier 在所有目标都开始发送后才返回的发送方式，串行发送时会一直等到超时
+type barrier struct {
+	wg *sync.WaitGroup
+}
+
+func (b barrier) Send(ctx context.Context, msg *Message, text string) error {
+	b.wg.Done()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestDispatcherSendsInParallel(t *testing.T) {
+	var wg sync.WaitGroup
+	var targets []*Target
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		targets = append(targets, &Target{Type: "barrier", On: "always", sender: barrier{&wg}, template: template.Must(template.New("").Parse(defaultTemplate))})
+	}
+	d := NewDispatcher(targets, "")
+
+	start := time.Now()
+	d.Observe(testConfig(t), finished(nil))
+	if elapsed := time.Since(start); elapsed >= sendTimeout {
+		t.Errorf("Observe took %s, targets were not sent in parallel", elapsed)
+	}
+}
+
+func TestDispatcherForgetsRemovedJobs(t *testing.T) {
+	rec := newRecorder(t)
+	targets, err := NewTargets([]config.Notify{{Type: "webhook", URL: secret.Value(rec.URL), On: "always"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(targets, "")
+
+	vault, other := testConfig(t), testConfig(t)
+	other.Name = "other"
+	d.Observe(vault, finished(errors.New("disk full")))
+	d.Observe(other, finished(errors.New("disk full")))
+
+	// vault 被移出配置后重新加入，不再视为从失败中恢复；other 保留失败状态
+	d.SetTargets(targets, "", []*config.Config{other})
+	d.Observe(vault, finished(nil))
+	d.Observe(other, finished(nil))
+
+	reqs := rec.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("received %d notifications, want 4", len(reqs))
+	}
+	if got := reqs[2].JSON(t)["status"]; got != StatusSuccess {
+		t.Errorf("vault status = %v, want %s", got, StatusSuccess)
+	}
+	if got := reqs[3].JSON(t)["status"]; got != StatusRecovery {
+		t.Errorf("other status = %v, want %s", got, StatusRecovery)
+	}
+}
@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/config"
+)
+
+// newSender 根据类型创建发送方式
+func newSender(cfg config.Notify) (Sender, error) {
+	endpoint := strings.TrimRight(cfg.URL.Reveal(), "/")
+	requireURL := func() error {
+		if endpoint == "" {
+			return fmt.Errorf("未设置 url")
+		}
+		return nil
+	}
+
+	switch cfg.Type {
+	case "webhook":
+		return webhook{url: endpoint}, requireURL()
+	case "discord":
+		return discord{url: endpoint}, requireURL()
+	case "slack":
+		return slack{url: endpoint}, requireURL()
+	case "telegram":
+		if cfg.Token.IsZero() || cfg.ChatID == "" {
+			return nil, fmt.Errorf("telegram 需要 token 和 chat_id")
+		}
+		if endpoint == "" {
+			endpoint = "https://api.telegram.org"
+		}
+		return telegram{url: endpoint, token: cfg.Token.Reveal(), chatID: cfg.ChatID}, nil
+	case "gotify":
+		if cfg.Token.IsZero() {
+			return nil, fmt.Errorf("gotify 需要 token")
+		}
+		return gotify{url: endpoint, token: cfg.Token.Reveal()}, requireURL()
+	case "ntfy":
+		return ntfy{url: endpoint, token: cfg.Token.Reveal()}, requireURL()
+	case "email":
+		return newEmail(cfg)
+	default:
+		return nil, fmt.Errorf("未知的通知类型，可选 webhook、discord、slack、telegram、gotify、ntfy、email")
+	}
+}
+
+// httpClient 发送通知使用的 HTTP 客户端
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// post 发送请求，非 2xx 响应视为失败；错误信息中不包含 URL，避免泄露其中的令牌
+func post(ctx context.Context, endpoint, contentType string, body []byte, header map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("无效的通知地址")
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "vaultwarden-backup")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("服务返回 %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func postJSON(ctx context.Context, endpoint string, payload any, header map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, endpoint, "application/json", body, header)
+}
+
+// webhook 通用 JSON Webhook，包含完整的运行报告
+type webhook struct{ url string }
+
+func (w webhook) Send(ctx context.Context, msg *Message, text string) error {
+	return postJSON(ctx, w.url, map[string]any{
+		"status":           msg.Status,
+		"title":            msg.Title(),
+		"message":          text,
+		"job":              msg.Job,
+		"backup_name":      msg.BackupName,
+		"duration_seconds": msg.Duration.Seconds(),
+		"archive":          msg.Archive,
+		"archive_size":     msg.Report.ArchiveSize,
+		"error":            msg.Error,
+		"report":           msg.Report,
+		"time":             time.Now().Format(time.RFC3339),
+	}, nil)
+}
+
+// discord Discord Webhook
+type discord struct{ url string }
+
+func (d discord) Send(ctx context.Context, _ *Message, text string) error {
+	return postJSON(ctx, d.url, map[string]string{"content": truncate(text, 2000)}, nil)
+}
+
+// slack Slack Incoming Webhook
+type slack struct{ url string }
+
+func (s slack) Send(ctx context.Context, _ *Message, text string) error {
+	return postJSON(ctx, s.url, map[string]string{"text": text}, nil)
+}
+
+// telegram Telegram Bot API sendMessage
+type telegram struct{ url, token, chatID string }
+
+func (t telegram) Send(ctx context.Context, _ *Message, text string) error {
+	return postJSON(ctx, t.url+"/bot"+t.token+"/sendMessage", map[string]string{
+		"chat_id": t.chatID,
+		"text":    truncate(text, 4096),
+	}, nil)
+}
+
+// gotify Gotify 消息接口
+type gotify struct{ url, token string }
+
+func (g gotify) Send(ctx context.Context, msg *Message, text string) error {
+	priority := 5
+	if msg.Status == StatusFailure {
+		priority = 8
+	}
+	return postJSON(ctx, g.url+"/message", map[string]any{
+		"title":    msg.Title(),
+		"message":  text,
+		"priority": priority,
+	}, map[string]string{"X-Gotify-Key": g.token})
+}
+
+// ntfy ntfy 主题，url 为完整的主题地址，如 https://ntfy.sh/my-backups
+type ntfy struct{ url, token string }
+
+func (n ntfy) Send(ctx context.Context, msg *Message, text string) error {
+	// 非 ASCII 的标题需要按 RFC 2047 编码
+	header := map[string]string{"Title": mime.QEncoding.Encode("utf-8", msg.Title()), "Tags": "floppy_disk"}
+	if msg.Status == StatusFailure {
+		header["Priority"] = "high"
+		header["Tags"] = "rotating_light"
+	}
+	if n.token != "" {
+		header["Authorization"] = "Bearer " + n.token
+	}
+	return post(ctx, n.url, "text/plain; charset=utf-8", []byte(text), header)
+}
+
+// truncate 按字符截断过长的消息
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
@@ -0,0 +1,268 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+)
+
+// request 测试服务器收到的一次请求
+type request struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// JSON 将请求体解码为 map
+func (r request) JSON(t *testing.T) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal(r.Body, &v); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", r.Body, err)
+	}
+	return v
+}
+
+// recorder 记录收到的请求，并以 status 响应
+type recorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []request
+	status   int
+}
+
+func newRecorder(t *testing.T) *recorder {
+	t.Helper()
+	rec := &recorder{status: http.StatusOK}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.requests = append(rec.requests, request{Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		status := rec.status
+		rec.mu.Unlock()
+		w.WriteHeader(status)
+		if status >= 300 {
+			io.WriteString(w, "rejected")
+		}
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+// Requests 返回已收到的请求
+func (r *recorder) Requests() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]request(nil), r.requests...)
+}
+
+// only 返回唯一的一次请求
+func (r *recorder) only(t *testing.T) request {
+	t.Helper()
+	reqs := r.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("received %d requests, want 1", len(reqs))
+	}
+	return reqs[0]
+}
+
+// testConfig 返回测试用的任务配置
+func testConfig(t *testing.T) *config.Config {
+	return &config.Config{Name: "vault", BackupName: "vw", BackupDir: t.TempDir()}
+}
+
+// testMessage 生成一条消息，err 非 nil 时为失败
+func testMessage(t *testing.T, status string, err error) *Message {
+	t.Helper()
+	rep := report.New("vault", "vw")
+	rep.AddTask("archive", 0, err)
+	rep.SetArchive("/backups/vw_20261019_120000.tar.gz", 2048)
+	rep.Finish(err)
+	return NewMessage(testConfig(t), rep.Snapshot(), status)
+}
+
+// send 创建目标并发送一条消息
+func send(t *testing.T, cfg config.Notify, msg *Message) error {
+	t.Helper()
+	target, err := newTarget(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target.Send(msg)
+}
+
+func TestWebhookPayload(t *testing.T) {
+	rec := newRecorder(t)
+	if err := send(t, config.Notify{Type: "webhook", URL: secret.Value(rec.URL + "/hook")}, testMessage(t, StatusSuccess, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	req := rec.only(t)
+	if req.Path != "/hook" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request = %s %s", req.Path, req.Header.Get("Content-Type"))
+	}
+	body := req.JSON(t)
+	for key, want := range map[string]any{
+		"status":       StatusSuccess,
+		"title":        "✅ Vaultwarden 备份成功: vault",
+		"job":          "vault",
+		"backup_name":  "vw",
+		"archive":      "vw_20261019_120000.tar.gz",
+		"archive_size": float64(2048),
+		"error":        "",
+	} {
+		if body[key] != want {
+			t.Errorf("%s = %v, want %v", key, body[key], want)
+		}
+	}
+	if msg, _ := body["message"].(string); !strings.Contains(msg, "备份名称: vw") {
+		t.Errorf("message = %q", msg)
+	}
+	if rep, _ := body["report"].(map[string]any); rep == nil || rep["job"] != "vault" {
+		t.Errorf("report = %v", body["report"])
+	}
+}
+
+func TestDiscordPayload(t *testing.T) {
+	rec := newRecorder(t)
+	cfg := config.Notify{Type: "discord", URL: secret.Value(rec.URL), Template: strings.Repeat("长", 2500)}
+	if err := send(t, cfg, testMessage(t, StatusFailure, errors.New("disk full"))); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := rec.only(t).JSON(t)["content"].(string)
+	if n := len([]rune(content)); n != 2000 || !strings.HasSuffix(content, "…") {
+		t.Errorf("content has %d characters, want 2000 ending in …", n)
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	rec := newRecorder(t)
+	if err := send(t, config.Notify{Type: "slack", URL: secret.Value(rec.URL)}, testMessage(t, StatusFailure, errors.New("disk full"))); err != nil {
+		t.Fatal(err)
+	}
+
+	text, _ := rec.only(t).JSON(t)["text"].(string)
+	if !strings.HasPrefix(text, "🚨 Vaultwarden 备份失败: vault") || !strings.Contains(text, "错误: disk full") {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestTelegramPayload(t *testing.T) {
+	rec := newRecorder(t)
+	cfg := config.Notify{Type: "telegram", URL: secret.Value(rec.URL + "/"), Token: "123:abc", ChatID: "-10042"}
+	if err := send(t, cfg, testMessage(t, StatusSuccess, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	req := rec.only(t)
+	if req.Path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s", req.Path)
+	}
+	body := req.JSON(t)
+	if body["chat_id"] != "-10042" || !strings.HasPrefix(body["text"].(string), "✅ Vaultwarden 备份成功") {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestGotifyPayload(t *testing.T) {
+	for _, tt := range []struct {
+		status   string
+		err      error
+		priority float64
+	}{
+		{StatusSuccess, nil, 5},
+		{StatusFailure, errors.New("disk full"), 8},
+	} {
+		rec := newRecorder(t)
+		if err := send(t, config.Notify{Type: "gotify", URL: secret.Value(rec.URL), Token: "app-token"}, testMessage(t, tt.status, tt.err)); err != nil {
+			t.Fatal(err)
+		}
+
+		req := rec.only(t)
+		if req.Path != "/message" || req.Header.Get("X-Gotify-Key") != "app-token" {
+			t.Errorf("request = %s, key %q", req.Path, req.Header.Get("X-Gotify-Key"))
+		}
+		body := req.JSON(t)
+		if body["priority"] != tt.priority || body["title"] != (&Message{Job: "vault", Status: tt.status}).Title() {
+			t.Errorf("%s: body = %v", tt.status, body)
+		}
+	}
+}
+
+func TestNtfyPayload(t *testing.T) {
+	rec := newRecorder(t)
+	cfg := config.Notify{Type: "ntfy", URL: secret.Value(rec.URL + "/backups"), Token: "tk_1"}
+	if err := send(t, cfg, testMessage(t, StatusFailure, errors.New("disk full"))); err != nil {
+		t.Fatal(err)
+	}
+
+	req := rec.only(t)
+	title, err := new(mime.WordDecoder).DecodeHeader(req.Header.Get("Title"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "🚨 Vaultwarden 备份失败: vault" {
+		t.Errorf("title = %q", title)
+	}
+	for key, want := range map[string]string{
+		"Priority":      "high",
+		"Tags":          "rotating_light",
+		"Authorization": "Bearer tk_1",
+		"Content-Type":  "text/plain; charset=utf-8",
+	} {
+		if got := req.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if req.Path != "/backups" || !strings.Contains(string(req.Body), "错误: disk full") {
+		t.Errorf("request = %s %q", req.Path, req.Body)
+	}
+}
+
+func TestSendErrorHidesURL(t *testing.T) {
+	rec := newRecorder(t)
+	rec.status = http.StatusForbidden
+
+	err := send(t, config.Notify{Type: "slack", URL: secret.Value(rec.URL + "/services/T000/B000/secret-token")}, testMessage(t, StatusSuccess, nil))
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("err = %v, want 403 with response body", err)
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error leaks the URL: %v", err)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	blocked := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-blocked:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(blocked)
+
+	sender, err := newSender(config.Notify{Type: "webhook", URL: secret.Value(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := sender.Send(ctx, testMessage(t, StatusSuccess, nil), "text"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
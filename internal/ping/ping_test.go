@@ -0,0 +1,202 @@
+package ping
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xg4/vaultwarden-backup/internal/report"
+)
+
+// hit 监控服务收到的一次请求
+type hit struct {
+	method string
+	query  string
+	body   string
+}
+
+// server 启动记录请求的监控服务，handle 返回每次请求的状态码
+func server(t *testing.T, handle func(n int, h hit) int) (*httptest.Server, func() []hit) {
+	t.Helper()
+	backoff = time.Millisecond
+	t.Cleanup(func() { backoff = time.Second })
+
+	var mu sync.Mutex
+	var hits []hit
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h := hit{method: r.Method, query: r.URL.RawQuery, body: string(body)}
+		mu.Lock()
+		hits = append(hits, h)
+		n := len(hits)
+		mu.Unlock()
+		w.WriteHeader(handle(n, h))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []hit {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]hit(nil), hits...)
+	}
+}
+
+func TestSendRID(t *testing.T) {
+	srv, hits := server(t, func(int, hit) int { return http.StatusOK })
+
+	send(context.Background(), "start", srv.URL+"/ping/abc/start?create=1", "run-1", nil)
+
+	got := hits()
+	if len(got) != 1 {
+		t.Fatalf("%d requests, want 1", len(got))
+	}
+	if got[0].method != http.MethodGet {
+		t.Errorf("method = %s, want GET", got[0].method)
+	}
+	if got[0].query != "create=1&rid=run-1" {
+		t.Errorf("query = %q, want the existing parameters and rid", got[0].query)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		fail  int // 前几次请求失败
+		calls int
+	}{
+		{"first attempt", 0, 1},
+		{"recovers", 2, 3},
+		{"gives up", 10, attempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := server(t, func(n int, _ hit) int {
+				if n <= tt.fail {
+					return http.StatusServiceUnavailable
+				}
+				return http.StatusOK
+			})
+
+			send(context.Background(), "success", srv.URL, "run-1", nil)
+
+			if got := len(hits()); got != tt.calls {
+				t.Errorf("%d requests, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	srv, hits := server(t, func(int, hit) int { return http.StatusBadGateway })
+	backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan struct{})
+	go func() {
+		send(ctx, "fail", srv.URL, "run-1", []byte("error"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send kept waiting after the context was canceled")
+	}
+	if got := len(hits()); got != 1 {
+		t.Errorf("%d requests, want 1", got)
+	}
+}
+
+func TestSendFallbackToGet(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusMethodNotAllowed} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			srv, hits := server(t, func(_ int, h hit) int {
+				if h.method == http.MethodPost {
+					return status
+				}
+				return http.StatusOK
+			})
+
+			send(context.Background(), "fail", srv.URL, "run-1", []byte("backup failed"))
+
+			got := hits()
+			if len(got) != 2 {
+				t.Fatalf("%d requests, want 2", len(got))
+			}
+			if got[0].method != http.MethodPost || got[0].body != "backup failed" {
+				t.Errorf("first request = %s %q, want POST with the body", got[0].method, got[0].body)
+			}
+			if got[1].method != http.MethodGet || got[1].query != "rid=run-1" {
+				t.Errorf("second request = %s ?%s, want GET with rid", got[1].method, got[1].query)
+			}
+		})
+	}
+}
+
+func TestSendNoFallbackOnServerError(t *testing.T) {
+	srv, hits := server(t, func(int, hit) int { return http.StatusInternalServerError })
+
+	send(context.Background(), "fail", srv.URL, "run-1", []byte("backup failed"))
+
+	for _, h := range hits() {
+		if h.method != http.MethodPost {
+			t.Errorf("method = %s, want only POST retries", h.method)
+		}
+	}
+}
+
+func TestFailBody(t *testing.T) {
+	rep := &report.Report{
+		ID:    "run-1",
+		Job:   "nightly",
+		Error: "磁盘空间不足",
+		Tasks: []report.TaskResult{
+			{Name: "备份数据库", Duration: 1500 * time.Millisecond},
+			{Name: "检查磁盘空间", Duration: 2 * time.Millisecond, Error: "磁盘空间不足"},
+		},
+		Log: []string{"first line", "last line"},
+	}
+
+	body := string(failBody(rep))
+	for _, want := range []string{
+		"备份任务: nightly\n",
+		"运行 ID: run-1\n",
+		"错误: 磁盘空间不足\n",
+		"- 备份数据库: 1.5s\n",
+		"- 检查磁盘空间: 2ms ❌\n",
+		"日志:\nfirst line\nlast line\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestFailBodyLimit(t *testing.T) {
+	// 多字节字符让截断点落在字符中间
+	line := strings.Repeat("日志", 100)
+	rep := &report.Report{ID: "run-1", Job: "nightly", Error: "失败"}
+	for i := 0; i < 100; i++ {
+		rep.Log = append(rep.Log, line)
+	}
+
+	body := failBody(rep)
+	if len(body) > maxBody {
+		t.Errorf("body is %d bytes, want at most %d", len(body), maxBody)
+	}
+	if len(body) < maxBody-utf8.UTFMax {
+		t.Errorf("body is %d bytes, truncated more than needed", len(body))
+	}
+	if !utf8.Valid(body) {
+		t.Error("body is not valid UTF-8 after truncation")
+	}
+	if !strings.HasPrefix(string(body), "备份任务: nightly\n") {
+		t.Error("body does not start with the summary")
+	}
+}
@@ -0,0 +1,237 @@
+package report
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TaskResult 单个任务的执行结果
+type TaskResult struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report 一次备份的运行报告，由各任务通过 context 填写。
+// 所有方法都允许在 nil 上调用，未携带报告的 context 不会出错
+type Report struct {
+	mu sync.Mutex
+
+	ID          string       `json:"id"`
+	Job         string       `json:"job"`
+	BackupName  string       `json:"backup_name"`
+	Start       time.Time    `json:"start"`
+	End         time.Time    `json:"end"`
+	Error       string       `json:"error,omitempty"`
+	Tasks       []TaskResult `json:"tasks"`
+	Archive     string       `json:"archive,omitempty"`      // 归档文件路径
+	ArchiveSize int64        `json:"archive_size,omitempty"` // 归档文件大小
+	Checksum    string       `json:"sha256,omitempty"`       // 归档文件的 SHA-256
+	DBEngine    string       `json:"db_engine,omitempty"`    // 数据库类型
+	DBVersion   string       `json:"db_version,omitempty"`   // 数据库版本
+	Files       int64        `json:"files"`                  // 归档中的文件数量
+	Bytes       int64        `json:"bytes"`                  // 归档前的数据总大小
+	Pruned      []string     `json:"pruned,omitempty"`       // 清理掉的旧归档
+	DiskFree    int64        `json:"disk_free"`              // 备份目录所在文件系统的可用空间
+	Log         []string     `json:"log,omitempty"`          // 运行期间最后 maxLogLines 条日志
+}
+
+// maxLogLines 报告中保留的日志行数
+const maxLogLines = 50
+
+// New 创建一次运行的报告，ID 为随机的 UUIDv4
+func New(job, backupName string) *Report {
+	return &Report{
+		ID:         newID(),
+		Job:        job,
+		BackupName: backupName,
+		Start:      time.Now(),
+	}
+}
+
+type contextKey struct{}
+
+// NewContext 返回携带报告的 context
+func NewContext(ctx context.Context, r *Report) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext 取出 context 中的报告，没有时返回 nil
+func FromContext(ctx context.Context) *Report {
+	r, _ := ctx.Value(contextKey{}).(*Report)
+	return r
+}
+
+// Finish 记录结束时间和最终错误
+func (r *Report) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.End = time.Now()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Duration 返回运行时长
+func (r *Report) Duration() time.Duration {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.End.IsZero() {
+		return time.Since(r.Start)
+	}
+	return r.End.Sub(r.Start)
+}
+
+// Failed 判断本次运行是否失败
+func (r *Report) Failed() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Error != ""
+}
+
+// AddTask 记录任务的执行时间和结果，并发任务可同时调用
+func (r *Report) AddTask(name string, d time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := TaskResult{Name: name, Duration: d}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.Tasks = append(r.Tasks, result)
+}
+
+// SetArchive 记录生成的归档文件
+func (r *Report) SetArchive(path string, size int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Archive = path
+	r.ArchiveSize = size
+}
+
+// SetChecksum 记录归档文件的 SHA-256
+func (r *Report) SetChecksum(sum string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Checksum = sum
+}
+
+// SetDatabase 记录数据库类型和版本
+func (r *Report) SetDatabase(engine, version string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.DBEngine = engine
+	r.DBVersion = version
+}
+
+// SetContents 记录归档内容的文件数量和总大小
+func (r *Report) SetContents(files, bytes int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Files = files
+	r.Bytes = bytes
+}
+
+// AddPruned 记录被清理的旧归档
+func (r *Report) AddPruned(path string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Pruned = append(r.Pruned, path)
+}
+
+// AddLog 记录一行运行日志，只保留最后 maxLogLines 行
+func (r *Report) AddLog(line string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Log) == maxLogLines {
+		r.Log = append(r.Log[:0], r.Log[1:]...)
+	}
+	r.Log = append(r.Log, line)
+}
+
+// SetDiskFree 记录备份目录的可用空间
+func (r *Report) SetDiskFree(bytes int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.DiskFree = bytes
+}
+
+// Snapshot 返回报告的副本，供并发读取
+func (r *Report) Snapshot() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Report{
+		ID:          r.ID,
+		Job:         r.Job,
+		BackupName:  r.BackupName,
+		Start:       r.Start,
+		End:         r.End,
+		Error:       r.Error,
+		Tasks:       append([]TaskResult(nil), r.Tasks...),
+		Archive:     r.Archive,
+		ArchiveSize: r.ArchiveSize,
+		Checksum:    r.Checksum,
+		DBEngine:    r.DBEngine,
+		DBVersion:   r.DBVersion,
+		Files:       r.Files,
+		Bytes:       r.Bytes,
+		Pruned:      append([]string(nil), r.Pruned...),
+		DiskFree:    r.DiskFree,
+		Log:         append([]string(nil), r.Log...),
+	}
+}
+
+// newID 生成 UUIDv4
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,76 @@
+package restore
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+)
+
+// ToDir 将备份解密到输出目录：先解密到输出目录内的暂存目录并按清单校验，
+// 通过后再逐个移入输出目录。输出目录中原有的其他文件不参与校验，同名文件被覆盖；
+// 校验失败时输出目录保持不变
+func ToDir(archiveFile, password, outputDir string) (*archive.Manifest, error) {
+	if err := utils.EnsureDir(outputDir); err != nil {
+		return nil, fmt.Errorf("创建输出目录失败: %w", err)
+	}
+
+	// 暂存目录与输出目录位于同一文件系统，移入时只需 rename
+	stagingDir := filepath.Join(outputDir, ".vaultr_restore_"+time.Now().Format("20060102_150405"))
+	defer utils.RemoveIfExists(stagingDir)
+
+	if err := os.Mkdir(stagingDir, 0700); err != nil {
+		return nil, fmt.Errorf("创建暂存目录失败: %w", err)
+	}
+
+	if err := archive.DecryptBackup(archiveFile, password, stagingDir); err != nil {
+		return nil, fmt.Errorf("解密归档失败: %w", err)
+	}
+
+	manifest, err := Verify(stagingDir)
+	if err != nil {
+		return manifest, fmt.Errorf("归档内容校验失败: %w", err)
+	}
+
+	if err := merge(stagingDir, outputDir); err != nil {
+		return manifest, fmt.Errorf("移入输出目录失败: %w", err)
+	}
+	return manifest, nil
+}
+
+// merge 将 src 中的文件逐个移入 dst，已存在的目录合并，已存在的文件被替换
+func merge(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if !d.IsDir() {
+			return os.Rename(path, target)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		existing, err := os.Stat(target)
+		switch {
+		case os.IsNotExist(err):
+			return os.Mkdir(target, info.Mode().Perm())
+		case err != nil:
+			return err
+		case !existing.IsDir():
+			return fmt.Errorf("%s 已存在且不是目录", target)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/pkg/targz"
+)
+
+// writeArchive 打包 files 生成加密归档；corrupt 为 true 时清单中的哈希被改错
+func writeArchive(t *testing.T, files map[string]string, corrupt bool) string {
+	t.Helper()
+	src := t.TempDir()
+	for name, data := range files {
+		writeFile(t, filepath.Join(src, name), data)
+	}
+
+	listed, err := archive.ManifestFiles(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupt {
+		listed[0].SHA256 = strings.Repeat("0", 64)
+	}
+
+	file := filepath.Join(t.TempDir(), "backup.tar.gz.enc")
+	if err := archive.EncryptedBackup(src, "pw", file, targz.DefaultCompression, archive.NewManifest(listed)); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestToDirKeepsUnrelatedFiles(t *testing.T) {
+	file := writeArchive(t, map[string]string{
+		"db.sqlite3":          "new db",
+		"attachments/a/1.bin": "attachment",
+	}, false)
+
+	out := t.TempDir()
+	writeFile(t, filepath.Join(out, "notes.txt"), "unrelated")
+	writeFile(t, filepath.Join(out, "attachments", "old.bin"), "unrelated")
+	writeFile(t, filepath.Join(out, "db.sqlite3"), "old db")
+
+	manifest, err := ToDir(file, "pw", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest == nil || len(manifest.Files) != 2 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	for path, want := range map[string]string{
+		"db.sqlite3":          "new db",
+		"attachments/a/1.bin": "attachment",
+		"attachments/old.bin": "unrelated",
+		"notes.txt":           "unrelated",
+	} {
+		if got := readFile(t, filepath.Join(out, path)); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".vaultr_restore_") {
+			t.Errorf("staging directory %s left behind", e.Name())
+		}
+	}
+}
+
+func TestToDirLeavesOutputUnchangedOnMismatch(t *testing.T) {
+	file := writeArchive(t, map[string]string{"db.sqlite3": "new db"}, true)
+
+	out := t.TempDir()
+	writeFile(t, filepath.Join(out, "db.sqlite3"), "old db")
+
+	_, err := ToDir(file, "pw", out)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("err = %v, want sha256 mismatch", err)
+	}
+	if got := readFile(t, filepath.Join(out, "db.sqlite3")); got != "old db" {
+		t.Errorf("db.sqlite3 = %q, want the original file", got)
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 1 {
+		t.Errorf("output contains %d entries, want 1", len(entries))
+	}
+}
+
+func TestToDirCreatesOutputDir(t *testing.T) {
+	file := writeArchive(t, map[string]string{"config.json": "{}"}, false)
+	out := filepath.Join(t.TempDir(), "restored")
+
+	if _, err := ToDir(file, "pw", out); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(out, "config.json")); got != "{}" {
+		t.Errorf("config.json = %q", got)
+	}
+}
@@ -0,0 +1,285 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/database"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"golang.org/x/sys/unix"
+)
+
+// ErrVaultwardenRunning 表示检测到 Vaultwarden 仍在使用数据目录
+var ErrVaultwardenRunning = errors.New("Vaultwarden 似乎正在运行")
+
+// Options 原地恢复的参数
+type Options struct {
+	ArchiveFile string // 加密备份文件路径
+	Password    string // 解密密码
+	DataDir     string // Vaultwarden 数据目录
+	DatabaseURL string // 目标数据库的 DATABASE_URL，为空时恢复 SQLite
+	Force       bool   // 忽略运行状态检查
+}
+
+// Result 原地恢复的结果
+type Result struct {
+	Engine      database.Engine   // 归档中的数据库类型
+	Version     string            // 备份时的数据库版本，旧版本归档为空
+	Manifest    *archive.Manifest // 归档中的清单，旧版本归档为 nil
+	RollbackDir string            // 原数据的回滚副本目录
+	Restored    []string          // 已替换的顶层文件或目录
+}
+
+// InPlace 将备份直接恢复到 Vaultwarden 数据目录：
+// 解密 -> 按清单校验 -> 数据库完整性检查或导入 -> 原数据移入回滚目录 -> 逐项原子替换
+func InPlace(opts Options) (*Result, error) {
+	info, err := os.Stat(opts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("无法访问数据目录: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("数据路径不是一个目录: %s", opts.DataDir)
+	}
+
+	if err := CheckNotRunning(opts.DataDir); err != nil && !opts.Force {
+		return nil, err
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+
+	// 暂存目录放在数据目录内，保证与目标位于同一文件系统，rename 才是原子的
+	stagingDir := filepath.Join(opts.DataDir, ".vaultr_restore_"+timestamp)
+	defer utils.RemoveIfExists(stagingDir)
+
+	if err := utils.EnsureDir(stagingDir); err != nil {
+		return nil, fmt.Errorf("创建暂存目录失败: %w", err)
+	}
+
+	if err := archive.DecryptBackup(opts.ArchiveFile, opts.Password, stagingDir); err != nil {
+		return nil, fmt.Errorf("解密归档失败: %w", err)
+	}
+
+	// 数据目录保持不变，直到所有文件都通过清单校验
+	manifest, err := Verify(stagingDir)
+	if err != nil {
+		return nil, fmt.Errorf("归档内容校验失败: %w", err)
+	}
+
+	engine, ok := database.DetectDump(stagingDir)
+	if !ok {
+		return nil, fmt.Errorf("归档中缺少数据库导出文件")
+	}
+
+	backend := database.New(opts.DatabaseURL, opts.DataDir)
+	if backend.Engine() != engine {
+		return nil, fmt.Errorf("归档中的数据库类型为 %s，但目标数据库为 %s，请设置正确的 DATABASE_URL", engine, backend.Engine())
+	}
+
+	// SQLite 只做完整性检查；其他数据库在替换文件前导入，失败时数据目录保持不变
+	if err := backend.Restore(stagingDir); err != nil {
+		return nil, fmt.Errorf("恢复数据库失败: %w", err)
+	}
+	dbInfo, _ := database.ReadInfo(stagingDir)
+
+	// 此后任何一步失败都要撤销已完成的文件替换，并删除已导入的表
+	var s *swapper
+	fail := func(err error) (*Result, error) {
+		if s != nil {
+			s.undo()
+		}
+		if cerr := backend.Clear(); cerr != nil {
+			return nil, fmt.Errorf("%w；回滚数据库导入失败，请手动清空数据库后重试: %v", err, cerr)
+		}
+		return nil, err
+	}
+
+	// 导出文件和元数据不属于 Vaultwarden 数据目录
+	cleanup := []string{database.InfoFile, archive.ManifestName}
+	if engine != database.SQLite {
+		cleanup = append(cleanup, database.DumpFile(engine))
+	}
+	for _, name := range cleanup {
+		if err := utils.RemoveIfExists(filepath.Join(stagingDir, name)); err != nil {
+			return fail(fmt.Errorf("清理 %s 失败: %w", name, err))
+		}
+	}
+
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return fail(fmt.Errorf("读取暂存目录失败: %w", err))
+	}
+
+	rollbackDir := filepath.Join(opts.DataDir, ".vaultr_rollback_"+timestamp)
+	if err := os.Mkdir(rollbackDir, 0700); err != nil {
+		return fail(fmt.Errorf("创建回滚目录失败: %w", err))
+	}
+
+	s = &swapper{dataDir: opts.DataDir, rollbackDir: rollbackDir}
+
+	// 旧的 WAL/SHM 文件与恢复的数据库不匹配，必须一并移走
+	for _, name := range []string{"db.sqlite3-wal", "db.sqlite3-shm", "db.sqlite3-journal"} {
+		if err := s.moveAside(name); err != nil {
+			return fail(err)
+		}
+	}
+
+	result := &Result{Engine: engine, Version: dbInfo.Version, Manifest: manifest, RollbackDir: rollbackDir}
+	for _, entry := range entries {
+		name := entry.Name()
+		if err := adoptTree(filepath.Join(stagingDir, name), filepath.Join(opts.DataDir, name), info); err != nil {
+			return fail(fmt.Errorf("设置 %s 所有者和权限失败: %w", name, err))
+		}
+		if err := s.moveAside(name); err != nil {
+			return fail(err)
+		}
+		if err := os.Rename(filepath.Join(stagingDir, name), filepath.Join(opts.DataDir, name)); err != nil {
+			return fail(fmt.Errorf("替换 %s 失败: %w", name, err))
+		}
+		s.placed = append(s.placed, name)
+		result.Restored = append(result.Restored, name)
+	}
+
+	return result, nil
+}
+
+// CheckNotRunning 通过 WAL/SHM 文件和数据库文件锁判断 Vaultwarden 是否仍在运行
+func CheckNotRunning(dataDir string) error {
+	for _, name := range []string{"db.sqlite3-wal", "db.sqlite3-shm"} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err == nil {
+			return fmt.Errorf("%w: 存在 %s", ErrVaultwardenRunning, name)
+		}
+	}
+
+	locked, err := isLocked(filepath.Join(dataDir, "db.sqlite3"))
+	if err != nil {
+		return fmt.Errorf("检查数据库锁失败: %w", err)
+	}
+	if locked {
+		return fmt.Errorf("%w: db.sqlite3 被其他进程锁定", ErrVaultwardenRunning)
+	}
+	return nil
+}
+
+// isLocked 检查文件上是否存在其他进程持有的 POSIX 记录锁（SQLite 使用的锁类型）
+func isLocked(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	lock := unix.Flock_t{Type: unix.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_GETLK, &lock); err != nil {
+		return false, err
+	}
+	return lock.Type != unix.F_UNLCK, nil
+}
+
+// swapper 记录替换过程中移动过的文件，失败时用于撤销
+type swapper struct {
+	dataDir     string
+	rollbackDir string
+	movedAside  []string // 已移入回滚目录的文件
+	placed      []string // 已放入数据目录的恢复文件
+}
+
+// moveAside 将数据目录中的现有文件移入回滚目录，不存在时跳过
+func (s *swapper) moveAside(name string) error {
+	src := filepath.Join(s.dataDir, name)
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.Rename(src, filepath.Join(s.rollbackDir, name)); err != nil {
+		return fmt.Errorf("移动 %s 到回滚目录失败: %w", name, err)
+	}
+	s.movedAside = append(s.movedAside, name)
+	return nil
+}
+
+// undo 尽力撤销已完成的替换，恢复原始数据
+func (s *swapper) undo() {
+	for _, name := range s.placed {
+		os.RemoveAll(filepath.Join(s.dataDir, name))
+	}
+	for _, name := range s.movedAside {
+		os.Rename(filepath.Join(s.rollbackDir, name), filepath.Join(s.dataDir, name))
+	}
+	os.Remove(s.rollbackDir)
+}
+
+// ownerOf 返回被替换文件的所有者，文件不存在时沿用数据目录的所有者
+func ownerOf(path string, fallback os.FileInfo) (int, int) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		info = fallback
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid)
+	}
+	return os.Getuid(), os.Getgid()
+}
+
+// adoptTree 让暂存的文件沿用将被替换的文件的所有者和权限：同一路径已存在时逐项沿用；
+// 新增的文件使用被替换顶层项（或数据目录）的所有者和数据目录的权限，普通文件去掉执行位。
+// 所有者仅在以 root 运行时设置
+func adoptTree(root, target string, dataDir os.FileInfo) error {
+	uid, gid := ownerOf(target, dataDir)
+
+	type change struct {
+		path     string
+		uid, gid int
+		perm     os.FileMode
+		link     bool
+	}
+	var changes []change
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		c := change{path: path, uid: uid, gid: gid, perm: dataDir.Mode().Perm(), link: info.Mode()&os.ModeSymlink != 0}
+		if !info.IsDir() {
+			c.perm &^= 0o111
+		}
+		if old, err := os.Lstat(filepath.Join(target, rel)); err == nil && old.Mode().Type() == info.Mode().Type() {
+			c.perm = old.Mode().Perm()
+			if st, ok := old.Sys().(*syscall.Stat_t); ok {
+				c.uid, c.gid = int(st.Uid), int(st.Gid)
+			}
+		}
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 先处理子项再处理目录，避免目录权限收紧后无法修改其中的文件
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if os.Geteuid() == 0 {
+			if err := os.Lchown(c.path, c.uid, c.gid); err != nil {
+				return err
+			}
+		}
+		if c.link {
+			continue
+		}
+		if err := os.Chmod(c.path, c.perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
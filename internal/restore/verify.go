@@ -0,0 +1,35 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+)
+
+// Verify 将解密出的文件与归档中的 MANIFEST.json 逐个比对，列出所有缺失或损坏的文件。
+// 旧版本归档没有清单，此时返回 nil, nil
+func Verify(dir string) (*archive.Manifest, error) {
+	m, err := archive.ReadManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches, err := m.VerifyDir(dir)
+	if err != nil {
+		return m, fmt.Errorf("校验文件失败: %w", err)
+	}
+	if len(mismatches) > 0 {
+		lines := make([]string, len(mismatches))
+		for i, mm := range mismatches {
+			lines[i] = "  " + mm.String()
+		}
+		return m, fmt.Errorf("%d 个文件与清单不一致:\n%s", len(mismatches), strings.Join(lines, "\n"))
+	}
+	return m, nil
+}
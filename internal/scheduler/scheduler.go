@@ -1,11 +1,14 @@
 package scheduler
 
 import (
+	"context"
 	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/logger"
+	"github.com/xg4/vaultwarden-backup/internal/report"
 )
 
 // Scheduler 任务调度器，支持串行和并行执行任务
@@ -27,18 +30,18 @@ func (s *Scheduler) Register(t ...Task) {
 	s.tasks = append(s.tasks, t)
 }
 
-// Start 开始执行所有已注册的任务
-func (s *Scheduler) Start() error {
+// Start 开始执行所有已注册的任务，每个任务的耗时和结果会记录到 ctx 中的运行报告
+func (s *Scheduler) Start(ctx context.Context) error {
 	for _, taskSlice := range s.tasks {
 		if len(taskSlice) == 1 {
 			// 单个任务直接执行
 			task := taskSlice[0]
-			if err := handleTask(task, s.cfg); err != nil {
+			if err := handleTask(ctx, task, s.cfg); err != nil {
 				return err
 			}
 		} else {
 			// 多个任务并行执行
-			if err := s.runConcurrentTasks(taskSlice); err != nil {
+			if err := s.runConcurrentTasks(ctx, taskSlice); err != nil {
 				return err
 			}
 		}
@@ -47,20 +50,22 @@ func (s *Scheduler) Start() error {
 }
 
 // handleTask 执行单个任务并记录执行时间和结果
-func handleTask(t Task, cfg *config.Config) error {
+func handleTask(ctx context.Context, t Task, cfg *config.Config) error {
+	ctx = logger.With(ctx, "task", t.Name())
 	start := time.Now()
-	err := t.Run(cfg)
+	err := t.Run(ctx, cfg)
 	duration := time.Since(start)
+	report.FromContext(ctx).AddTask(t.Name(), duration, err)
 	if err != nil {
-		slog.Error("❌ 任务失败", "task", t.Name(), "error", err)
+		slog.ErrorContext(ctx, "❌ 任务失败", "error", err)
 		return err
 	}
-	slog.Debug("✅ 任务完成", "task", t.Name(), "duration", duration)
+	slog.DebugContext(ctx, "✅ 任务完成", "duration", duration)
 	return nil
 }
 
 // runConcurrentTasks 并行执行多个任务
-func (s *Scheduler) runConcurrentTasks(tasks []Task) error {
+func (s *Scheduler) runConcurrentTasks(ctx context.Context, tasks []Task) error {
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(tasks))
 
@@ -69,7 +74,7 @@ func (s *Scheduler) runConcurrentTasks(tasks []Task) error {
 		wg.Add(1)
 		go func(t Task) {
 			defer wg.Done()
-			if err := handleTask(t, s.cfg); err != nil {
+			if err := handleTask(ctx, t, s.cfg); err != nil {
 				errChan <- err
 				return
 			}
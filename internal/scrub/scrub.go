@@ -0,0 +1,185 @@
+package scrub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/logger"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/pkg/crypto"
+	"github.com/xg4/vaultwarden-backup/pkg/parity"
+)
+
+// Report 一次巡检的结果。嵌入的运行报告记录 ID、起止时间和日志，每个归档作为一个任务，用于通知
+type Report struct {
+	*report.Report
+	Results []Result
+}
+
+// Result 单个归档的巡检结果
+type Result struct {
+	Archive  string // 归档文件名
+	Size     int64
+	Status   string // catalog.CheckOK、CheckCorrupt 或 CheckError
+	Problem  string
+	Duration time.Duration
+}
+
+// Corrupted 返回本次发现损坏的归档
+func (r *Report) Corrupted() []Result {
+	var corrupted []Result
+	for _, res := range r.Results {
+		if res.Status == catalog.CheckCorrupt {
+			corrupted = append(corrupted, res)
+		}
+	}
+	return corrupted
+}
+
+// Run 逐个重新校验备份目录中的归档：与备份记录中的 SHA-256 比对，解密并检查认证标签，读取 tar 结构并与清单比对。
+// 读取速度受 ScrubRateLimit 限制；每个归档在持有 lock 时检查，避免与同一任务的备份和清理同时进行。
+// 结果追加到备份目录中的巡检记录文件；ctx 取消时中止，返回已完成的结果和 ctx 的错误
+func Run(ctx context.Context, cfg *config.Config, lock sync.Locker) (*Report, error) {
+	rep := &Report{Report: report.New(cfg.Name, cfg.BackupName)}
+	ctx = report.NewContext(ctx, rep.Report)
+	ctx = logger.With(ctx, "run_id", rep.ID, "job", cfg.Name)
+
+	entries, err := archive.List(cfg.BackupDir, cfg.BackupName)
+	if err != nil {
+		err = fmt.Errorf("查找归档失败: %w", err)
+		rep.Finish(err)
+		return rep, err
+	}
+
+	// 备份记录中的校验和可以区分归档损坏和密码已更改
+	records, err := catalog.Load(cfg.BackupDir)
+	if err != nil {
+		slog.WarnContext(ctx, "⚠️ 读取备份目录文件失败，跳过校验和比对", "error", err)
+	}
+	known := catalog.Archives(records)
+
+	slog.InfoContext(ctx, "🔍 开始巡检归档", "archives", len(entries), "rate_limit_mb", cfg.ScrubRateLimit)
+
+	for _, e := range entries {
+		lock.Lock()
+		start := time.Now()
+		res, ok := check(ctx, cfg, e, known[filepath.Base(e.Path)].SHA256)
+		res.Duration = time.Since(start)
+		lock.Unlock()
+		if ctx.Err() != nil {
+			break
+		}
+		if !ok {
+			continue // 巡检期间已被清理
+		}
+
+		rep.Results = append(rep.Results, res)
+		var taskErr error
+		if res.Problem != "" {
+			taskErr = errors.New(res.Problem)
+		}
+		rep.AddTask(res.Archive, res.Duration, taskErr)
+
+		switch res.Status {
+		case catalog.CheckCorrupt:
+			slog.ErrorContext(ctx, "🚨 归档已损坏", "archive", res.Archive, "problem", res.Problem)
+		case catalog.CheckError:
+			slog.WarnContext(ctx, "⚠️ 无法校验归档", "archive", res.Archive, "problem", res.Problem)
+		default:
+			slog.DebugContext(ctx, "✅ 归档校验通过", "archive", res.Archive, "duration", res.Duration)
+		}
+	}
+
+	checks := make([]catalog.Check, 0, len(rep.Results))
+	for _, res := range rep.Results {
+		checks = append(checks, catalog.Check{
+			RunID: rep.ID, Job: cfg.Name, Archive: res.Archive, Time: time.Now(), Status: res.Status, Problem: res.Problem,
+		})
+	}
+	if len(checks) > 0 {
+		if err := catalog.AppendChecks(cfg.BackupDir, checks); err != nil {
+			slog.WarnContext(ctx, "⚠️ 写入巡检记录失败", "error", err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		slog.InfoContext(ctx, "⏹️ 巡检已中止", "checked", len(rep.Results))
+		rep.Finish(err)
+		return rep, err
+	}
+
+	var runErr error
+	if corrupted := rep.Corrupted(); len(corrupted) > 0 {
+		names := make([]string, len(corrupted))
+		for i, res := range corrupted {
+			names[i] = res.Archive
+		}
+		runErr = fmt.Errorf("%d 个归档已损坏: %s", len(corrupted), strings.Join(names, ", "))
+	}
+	rep.Finish(runErr)
+	slog.InfoContext(ctx, "✅ 巡检完成", "checked", len(rep.Results), "corrupted", len(rep.Corrupted()), "duration", rep.Duration().Round(time.Millisecond))
+	return rep, nil
+}
+
+// check 校验单个归档，归档已不存在时返回 false
+func check(ctx context.Context, cfg *config.Config, e archive.Entry, recorded string) (Result, bool) {
+	res := Result{Archive: filepath.Base(e.Path), Size: e.Size, Status: catalog.CheckOK}
+
+	f, err := os.Open(e.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return res, false
+	}
+	if err != nil {
+		res.Status, res.Problem = catalog.CheckError, err.Error()
+		return res, true
+	}
+	defer f.Close()
+
+	// 解密的同时计算整个文件的校验和
+	h := sha256.New()
+	r := io.TeeReader(newThrottle(ctx, f, int64(cfg.ScrubRateLimit)*1024*1024), h)
+	_, mismatches, verr := archive.VerifyStream(r, cfg.Password.Reveal(), nil)
+	if _, err := io.Copy(io.Discard, r); err != nil && verr == nil {
+		verr = err
+	}
+	if ctx.Err() != nil {
+		return res, true
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	switch {
+	case recorded != "" && sum != recorded:
+		res.Status, res.Problem = catalog.CheckCorrupt, "SHA-256 与备份记录不一致"
+	case verr != nil && recorded != "":
+		// 文件与备份时完全一致却无法解密，通常是密码已更改
+		res.Status, res.Problem = catalog.CheckError, "文件未损坏但无法解密，密码可能已更改: "+verr.Error()
+	case errors.Is(verr, crypto.ErrAuthentication):
+		// 没有备份记录可比对时，认证失败既可能是文件损坏也可能是密码错误，无法断定已损坏
+		res.Status, res.Problem = catalog.CheckError, "无法解密（文件已损坏或密码错误），没有备份记录可供区分: "+verr.Error()
+	case verr != nil:
+		res.Status, res.Problem = catalog.CheckCorrupt, verr.Error()
+	case len(mismatches) > 0:
+		problems := make([]string, len(mismatches))
+		for i, m := range mismatches {
+			problems[i] = m.String()
+		}
+		res.Status, res.Problem = catalog.CheckCorrupt, "与清单不一致: "+strings.Join(problems, "; ")
+	}
+	if _, err := os.Stat(e.Path + parity.Ext); err == nil && res.Status == catalog.CheckCorrupt {
+		res.Problem += "（存在纠错数据，可尝试 vaultr repair 修复）"
+	}
+	return res, true
+}
@@ -0,0 +1,109 @@
+package scrub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+	"github.com/xg4/vaultwarden-backup/pkg/targz"
+)
+
+// writeArchive 生成一个加密归档，badManifest 为 true 时清单中的哈希被改错；返回归档条目和文件的 SHA-256
+func writeArchive(t *testing.T, badManifest bool) (archive.Entry, string) {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "db.sqlite3"), []byte("database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := archive.ManifestFiles(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if badManifest {
+		files[0].SHA256 = strings.Repeat("0", 64)
+	}
+
+	file := filepath.Join(t.TempDir(), "vault_20261019_120000.tar.gz")
+	if err := archive.EncryptedBackup(src, "pw", file, targz.DefaultCompression, archive.NewManifest(files)); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Entry{Path: file}, sha256File(t, file)
+}
+
+func sha256File(t *testing.T, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// flipByte 改动归档末尾的一个字节，模拟位损坏
+func flipByte(t *testing.T, file string) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		badManifest bool
+		damage      bool
+		recorded    bool
+		want        string
+	}{
+		{name: "ok", password: "pw", recorded: true, want: catalog.CheckOK},
+		{name: "ok without record", password: "pw", want: catalog.CheckOK},
+		{name: "damaged with record", password: "pw", damage: true, recorded: true, want: catalog.CheckCorrupt},
+		{name: "password changed with record", password: "other", recorded: true, want: catalog.CheckError},
+		{name: "password changed without record", password: "other", want: catalog.CheckError},
+		{name: "damaged without record", password: "pw", damage: true, want: catalog.CheckError},
+		{name: "manifest mismatch without record", password: "pw", badManifest: true, want: catalog.CheckCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, sum := writeArchive(t, tt.badManifest)
+			if tt.damage {
+				flipByte(t, e.Path)
+			}
+			recorded := ""
+			if tt.recorded {
+				recorded = sum
+			}
+
+			cfg := &config.Config{Password: secret.Value(tt.password)}
+			res, ok := check(context.Background(), cfg, e, recorded)
+			if !ok {
+				t.Fatal("archive reported as missing")
+			}
+			if res.Status != tt.want {
+				t.Errorf("status = %s (%s), want %s", res.Status, res.Problem, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMissingArchive(t *testing.T) {
+	e := archive.Entry{Path: filepath.Join(t.TempDir(), "gone.tar.gz")}
+	if _, ok := check(context.Background(), &config.Config{}, e, ""); ok {
+		t.Error("missing archive was checked")
+	}
+}
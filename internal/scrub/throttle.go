@@ -0,0 +1,48 @@
+package scrub
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttle 限制读取速度的 Reader，ctx 取消后读取返回 ctx 的错误
+type throttle struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64 // 每秒字节数，0 表示不限速
+	start time.Time
+	read  int64
+}
+
+func newThrottle(ctx context.Context, r io.Reader, rate int64) *throttle {
+	return &throttle{ctx: ctx, r: r, rate: rate, start: time.Now()}
+}
+
+func (t *throttle) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	// 每次最多读取 100ms 的配额，使读取均匀分布
+	if chunk := t.rate / 10; t.rate > 0 && int64(len(p)) > chunk {
+		p = p[:max(chunk, 1)]
+	}
+
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	if t.rate <= 0 {
+		return n, err
+	}
+
+	wait := time.Duration(float64(t.read)/float64(t.rate)*float64(time.Second)) - time.Since(t.start)
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,130 @@
+package secret
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNotProvided 表示所有来源都没有提供密码
+var ErrNotProvided = errors.New("未提供密码")
+
+// Sources 描述密码的可选来源，按字段顺序依次尝试
+type Sources struct {
+	Flag   string    // 命令行参数直接传入的明文（会出现在 shell 历史和 ps 中）
+	File   string    // 密码文件路径
+	Stdin  io.Reader // 非空时从该输入读取第一行
+	Env    string    // 环境变量名
+	Prompt string    // 非空时在终端上以此提示无回显输入
+}
+
+// Resolve 按优先级从各来源读取密码：参数 > 文件 > 标准输入 > 环境变量 > 终端输入
+func Resolve(s Sources) (string, error) {
+	if s.Flag != "" {
+		return s.Flag, nil
+	}
+
+	if s.File != "" {
+		return ReadFile(s.File)
+	}
+
+	if s.Stdin != nil {
+		return Read(s.Stdin)
+	}
+
+	if s.Env != "" {
+		if value := os.Getenv(s.Env); strings.TrimSpace(value) != "" {
+			return value, nil
+		}
+	}
+
+	if s.Prompt != "" {
+		return PromptTTY(s.Prompt)
+	}
+
+	return "", ErrNotProvided
+}
+
+// ReadFile 读取密码文件，去掉末尾换行
+func ReadFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("读取密码文件失败: %w", err)
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read 读取输入的第一行作为密码
+func Read(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("读取密码失败: %w", err)
+	}
+
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		return "", ErrNotProvided
+	}
+	return value, nil
+}
+
+// PromptTTY 在控制终端上提示输入密码，输入内容不回显
+func PromptTTY(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("%w: 无法打开终端", ErrNotProvided)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	value, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", fmt.Errorf("读取终端输入失败: %w", err)
+	}
+
+	if len(value) == 0 {
+		return "", ErrNotProvided
+	}
+	return string(value), nil
+}
+
+// redacted 敏感值在输出中的替代文本
+const redacted = "******"
+
+// Value 敏感配置值，在 slog 日志、fmt 格式化和 JSON 中自动脱敏
+type Value string
+
+// Reveal 返回原始值，仅在真正需要使用密钥时调用
+func (v Value) Reveal() string { return string(v) }
+
+// IsZero 判断是否未设置
+func (v Value) IsZero() bool { return v == "" }
+
+func (v Value) String() string {
+	if v == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Format 对所有格式化动词（包括 %#v）统一输出脱敏文本
+func (v Value) Format(f fmt.State, _ rune) { io.WriteString(f, v.String()) }
+
+// LogValue 实现 slog.LogValuer
+func (v Value) LogValue() slog.Value { return slog.StringValue(v.String()) }
+
+// MarshalJSON 序列化时同样脱敏
+func (v Value) MarshalJSON() ([]byte, error) { return json.Marshal(v.String()) }
+
+// MarshalText 供 YAML 等基于文本的编码器使用，同样脱敏
+func (v Value) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
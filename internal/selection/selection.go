@@ -0,0 +1,114 @@
+package selection
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xg4/vaultwarden-backup/pkg/pattern"
+)
+
+// DefaultInclude 默认备份的文件和目录（数据库和 RSA 密钥始终备份，不受规则影响）
+var DefaultInclude = []string{"/.env", "/config.json", "/attachments/", "/sends/"}
+
+// Item 一个可备份的顶层文件或目录
+type Item struct {
+	Path string // 归档中的相对路径
+	Src  string // 实际的源路径
+}
+
+// Selector 根据 INCLUDE/EXCLUDE 规则决定哪些文件参与备份，路径均为归档中的相对路径
+type Selector struct {
+	include *pattern.Matcher
+	exclude *pattern.Matcher
+}
+
+// New 创建选择器，include 为空时使用 DefaultInclude
+func New(include, exclude []string) (*Selector, error) {
+	if len(include) == 0 {
+		include = DefaultInclude
+	}
+
+	inc, err := pattern.New(include)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 INCLUDE 规则: %w", err)
+	}
+	exc, err := pattern.New(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 EXCLUDE 规则: %w", err)
+	}
+	return &Selector{include: inc, exclude: exc}, nil
+}
+
+// File 判断文件是否参与备份
+func (s *Selector) File(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	return s.include.Match(rel, false) && !s.exclude.Match(rel, false)
+}
+
+// Dir 判断是否需要进入目录：目录未被排除，且目录本身或其下的文件可能被包含
+func (s *Selector) Dir(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if s.exclude.Match(rel, true) {
+		return false
+	}
+	return s.include.Match(rel, true) || s.include.CouldMatchUnder(rel)
+}
+
+// Filter 返回供 utils.CopyDir 使用的过滤函数，base 为目录在归档中的相对路径
+func (s *Selector) Filter(base string) func(rel string, info os.FileInfo) bool {
+	return func(rel string, info os.FileInfo) bool {
+		name := filepath.Join(base, rel)
+		if info.IsDir() {
+			return s.Dir(name)
+		}
+		return s.File(name)
+	}
+}
+
+// Walk 遍历条目中所有被选中的文件
+func (s *Selector) Walk(items []Item, fn func(rel, src string, info os.FileInfo) error) error {
+	for _, item := range items {
+		info, err := os.Stat(item.Src)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			if s.File(item.Path) {
+				if err := fn(item.Path, item.Src, info); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		filter := s.Filter(item.Path)
+		err = filepath.Walk(item.Src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(item.Src, path)
+			if err != nil {
+				return err
+			}
+			if !filter(relPath, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return fn(filepath.Join(item.Path, relPath), path, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -8,7 +9,9 @@ import (
 
 	"github.com/xg4/vaultwarden-backup/internal/archive"
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
 	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/internal/version"
 )
 
 type ArchiveTask struct {
@@ -17,7 +20,7 @@ type ArchiveTask struct {
 
 func (c *ArchiveTask) Name() string { return "归档" }
 
-func (c *ArchiveTask) Run(cfg *config.Config) error {
+func (c *ArchiveTask) Run(ctx context.Context, cfg *config.Config) error {
 	entries, err := os.ReadDir(cfg.TmpDir)
 	if err != nil {
 		return fmt.Errorf("读取备份目录失败: %w", err)
@@ -27,56 +30,71 @@ func (c *ArchiveTask) Run(cfg *config.Config) error {
 		return fmt.Errorf("备份目录为空")
 	}
 
-	archiveFile := filepath.Join(cfg.BackupDir, fmt.Sprintf("%s_%s.tar.gz", cfg.BackupName, c.Timestamp))
-	slog.Debug("🔐 创建加密归档", "file", filepath.Base(archiveFile))
+	// 生成清单：逐个文件记录大小、权限、修改时间和 SHA-256，作为归档的第一个条目
+	manifest, err := c.manifest(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("生成清单失败: %w", err)
+	}
+
+	archiveFile := filepath.Join(cfg.BackupDir, archive.FileName(cfg.BackupName, c.Timestamp, cfg.Compression))
+	slog.DebugContext(ctx, "🔐 创建加密归档", "file", filepath.Base(archiveFile), "files", len(manifest.Files), "compression", cfg.Compression.String())
 
 	// 创建加密归档
-	if err := archive.EncryptedBackup(cfg.TmpDir, cfg.Password, archiveFile); err != nil {
+	if err := archive.EncryptedBackup(cfg.TmpDir, cfg.Password.Reveal(), archiveFile, cfg.Compression, manifest); err != nil {
 		utils.RemoveIfExists(archiveFile)
 		return fmt.Errorf("创建加密归档失败: %w", err)
 	}
 
-	// 验证归档完整性
-	slog.Debug("🔎 开始验证归档完整性")
-
-	// 计算原始备份目录的哈希值
-	slog.Debug("🧮 计算原始目录哈希", "dir", cfg.TmpDir)
-	sourceHash, err := utils.HashDir(cfg.TmpDir)
+	// 验证归档完整性：在内存中解密并读取 tar，逐个条目计算 SHA-256 与清单比对，不写入磁盘
+	slog.DebugContext(ctx, "🔎 开始验证归档完整性")
+	_, mismatches, err := archive.VerifyBackup(archiveFile, cfg.Password.Reveal(), manifest)
 	if err != nil {
 		utils.RemoveIfExists(archiveFile)
-		return fmt.Errorf("计算原始目录哈希失败: %w", err)
+		return fmt.Errorf("验证归档失败: %w", err)
 	}
-	slog.Debug("✨ 原始目录哈希", "hash", sourceHash)
-
-	// 解密到单独的验证目录
-	verifyDir := filepath.Join(cfg.BackupDir, "/.verify_tmp")
-	defer utils.RemoveIfExists(verifyDir) // 确保验证目录被清理
-
-	if err := utils.EnsureDir(verifyDir); err != nil {
+	if len(mismatches) > 0 {
 		utils.RemoveIfExists(archiveFile)
-		return fmt.Errorf("创建验证目录失败: %w", err)
+		return fmt.Errorf("归档完整性验证失败: %s", mismatches[0])
 	}
 
-	if err := archive.DecryptBackup(archiveFile, cfg.Password, verifyDir); err != nil {
-		utils.RemoveIfExists(archiveFile)
-		return fmt.Errorf("解密归档失败: %w", err)
+	slog.DebugContext(ctx, "✅ 归档验证成功", "file", filepath.Base(archiveFile))
+
+	if info, err := os.Stat(archiveFile); err == nil {
+		report.FromContext(ctx).SetArchive(archiveFile, info.Size())
 	}
 
-	// 计算验证目录的哈希值
-	slog.Debug("🧮 计算验证目录哈希", "dir", verifyDir)
-	verifyHash, err := utils.HashDir(verifyDir)
+	// 记录归档的校验和，恢复前可据此检查归档是否损坏
+	sum, err := utils.HashFile(archiveFile)
 	if err != nil {
-		utils.RemoveIfExists(archiveFile)
-		return fmt.Errorf("计算验证目录哈希失败: %w", err)
+		return fmt.Errorf("计算归档校验和失败: %w", err)
 	}
-	slog.Debug("✨ 验证目录哈希", "hash", verifyHash)
+	report.FromContext(ctx).SetChecksum(sum)
+	return nil
+}
 
-	// 比较哈希值
-	if sourceHash != verifyHash {
-		utils.RemoveIfExists(archiveFile)
-		return fmt.Errorf("归档完整性验证失败: 哈希值不匹配")
+// manifest 为临时目录中的文件生成清单，并记录内容统计
+func (c *ArchiveTask) manifest(ctx context.Context, cfg *config.Config) (*archive.Manifest, error) {
+	files, err := archive.ManifestFiles(cfg.TmpDir)
+	if err != nil {
+		return nil, err
 	}
 
-	slog.Debug("✅ 归档验证成功", "file", filepath.Base(archiveFile))
-	return nil
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	rep := report.FromContext(ctx)
+	rep.SetContents(int64(len(files)), size)
+
+	m := archive.NewManifest(files)
+	m.Tool = version.String()
+	m.Job = cfg.Name
+	m.BackupName = cfg.BackupName
+	m.DataDir = cfg.DataDir
+	if rep != nil {
+		if snap := rep.Snapshot(); snap.DBEngine != "" {
+			m.Database = &archive.ManifestDatabase{Engine: snap.DBEngine, Version: snap.DBVersion}
+		}
+	}
+	return m, nil
 }
@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -8,56 +9,90 @@ import (
 	"sort"
 	"time"
 
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/catalog"
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/pkg/parity"
+	"github.com/xg4/vaultwarden-backup/pkg/sign"
 )
 
 type CleanupTask struct{}
 
 func (c *CleanupTask) Name() string { return "清理" }
 
-func (c *CleanupTask) Run(cfg *config.Config) error {
+func (c *CleanupTask) Run(ctx context.Context, cfg *config.Config) error {
+	// 无论是否设置了保留策略，都删除已不存在的归档的运行记录和巡检结果
+	defer c.compact(ctx, cfg.BackupDir)
+
 	if cfg.PruneBackupsDays <= 0 && cfg.PruneBackupsCount <= 0 {
 		return nil
 	}
 
 	if cfg.PruneBackupsDays > 0 && cfg.PruneBackupsCount > 0 {
-		slog.Warn("⚠️ PRUNE_BACKUPS_DAYS and PRUNE_BACKUPS_COUNT are both set. PRUNE_BACKUPS_COUNT will be used.")
+		slog.WarnContext(ctx, "⚠️ PRUNE_BACKUPS_DAYS and PRUNE_BACKUPS_COUNT are both set. PRUNE_BACKUPS_COUNT will be used.")
 	}
 
-	globPattern := filepath.Join(cfg.BackupDir, fmt.Sprintf("%s_*.tar.gz", cfg.BackupName))
-	files, err := filepath.Glob(globPattern)
+	// 按名称精确匹配，避免误删同一目录下其他任务（如 vault 与 vault_b）的备份
+	entries, err := archive.List(cfg.BackupDir, cfg.BackupName)
 	if err != nil {
 		return fmt.Errorf("查找旧备份失败: %w", err)
 	}
-	slog.Debug("🔍 扫描备份文件", "found", len(files))
+	slog.DebugContext(ctx, "🔍 扫描备份文件", "found", len(entries))
 
-	if cfg.PruneBackupsCount > 0 {
-		if len(files) <= cfg.PruneBackupsCount {
-			return nil
+	// 备份时间优先取目录文件中的记录，其次取文件名中的时间戳，不依赖可能被复制或同步改变的修改时间
+	records, err := catalog.Load(cfg.BackupDir)
+	if err != nil {
+		slog.WarnContext(ctx, "⚠️ 读取备份目录文件失败，使用文件名中的时间", "error", err)
+	}
+	known := catalog.Archives(records)
+	for i, e := range entries {
+		if rec, ok := known[filepath.Base(e.Path)]; ok {
+			entries[i].Time = rec.Start
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	// 巡检发现损坏的归档不算作保留的副本，不会因为它们而删除最后一个完好的备份
+	checks, err := catalog.LoadChecks(cfg.BackupDir)
+	if err != nil {
+		slog.WarnContext(ctx, "⚠️ 读取巡检记录失败", "error", err)
+	}
+	corrupted := catalog.Corrupted(checks)
+	good := make([]bool, len(entries))
+	lastGood := -1
+	for i, e := range entries {
+		if _, bad := corrupted[filepath.Base(e.Path)]; !bad {
+			good[i], lastGood = true, i
+		} else {
+			slog.WarnContext(ctx, "⚠️ 归档已损坏，不计入保留数量", "file", filepath.Base(e.Path))
 		}
+	}
 
-		// Sort files by modification time, oldest first
-		sort.Slice(files, func(i, j int) bool {
-			infoI, errI := os.Stat(files[i])
-			infoJ, errJ := os.Stat(files[j])
-			if errI != nil || errJ != nil {
-				return false
+	if cfg.PruneBackupsCount > 0 {
+		// 从最新的归档往前保留 PruneBackupsCount 个完好的归档，删除更早的归档
+		cut, kept := -1, 0
+		for i := len(entries) - 1; i >= 0 && cut < 0; i-- {
+			if good[i] {
+				if kept++; kept == cfg.PruneBackupsCount {
+					cut = i
+				}
 			}
-			return infoI.ModTime().Before(infoJ.ModTime())
-		})
+		}
+		if cut <= 0 {
+			return nil
+		}
 
-		filesToDelete := files[:len(files)-cfg.PruneBackupsCount]
 		count := 0
-		for _, file := range filesToDelete {
-			if err := os.Remove(file); err != nil {
-				slog.Warn("⚠️ 删除失败", "file", filepath.Base(file), "error", err)
-			} else {
+		for _, e := range entries[:cut] {
+			if c.remove(ctx, e.Path) {
 				count++
 			}
 		}
 
 		if count > 0 {
-			slog.Info("🧹 清理过期备份", "deleted", count, "keep_count", cfg.PruneBackupsCount)
+			slog.InfoContext(ctx, "🧹 清理过期备份", "deleted", count, "keep_count", cfg.PruneBackupsCount)
 		}
 
 		return nil
@@ -66,25 +101,46 @@ func (c *CleanupTask) Run(cfg *config.Config) error {
 	if cfg.PruneBackupsDays > 0 {
 		cutoffTime := time.Now().AddDate(0, 0, -cfg.PruneBackupsDays)
 		count := 0
-		for _, file := range files {
-			info, err := os.Stat(file)
-			if err != nil {
-				slog.Warn("⚠️ 无法读取文件信息", "file", filepath.Base(file), "error", err)
-				continue
-			}
-			if info.ModTime().Before(cutoffTime) {
-				if err := os.Remove(file); err != nil {
-					slog.Warn("⚠️ 删除失败", "file", filepath.Base(file), "error", err)
-				} else {
-					count++
-				}
+		for i, e := range entries {
+			// 始终保留最新的完好归档，即使它已过期
+			if i != lastGood && e.Time.Before(cutoffTime) && c.remove(ctx, e.Path) {
+				count++
 			}
 		}
 
 		if count > 0 {
-			slog.Info("🧹 清理过期备份", "deleted", count, "prune_backups_days", cfg.PruneBackupsDays)
+			slog.InfoContext(ctx, "🧹 清理过期备份", "deleted", count, "prune_backups_days", cfg.PruneBackupsDays)
 		}
 	}
 
 	return nil
 }
+
+// compact 从目录文件和巡检记录中删除已被清理的归档的记录，失败只记录警告
+func (c *CleanupTask) compact(ctx context.Context, dir string) {
+	if n, err := catalog.Prune(dir); err != nil {
+		slog.WarnContext(ctx, "⚠️ 清理备份目录文件失败", "error", err)
+	} else if n > 0 {
+		slog.DebugContext(ctx, "🧹 清理运行记录", "deleted", n)
+	}
+	if n, err := catalog.PruneChecks(dir); err != nil {
+		slog.WarnContext(ctx, "⚠️ 清理巡检记录失败", "error", err)
+	} else if n > 0 {
+		slog.DebugContext(ctx, "🧹 清理巡检记录", "deleted", n)
+	}
+}
+
+// remove 删除旧归档及其纠错数据，并记入运行报告
+func (c *CleanupTask) remove(ctx context.Context, file string) bool {
+	if err := os.Remove(file); err != nil {
+		slog.WarnContext(ctx, "⚠️ 删除失败", "file", filepath.Base(file), "error", err)
+		return false
+	}
+	for _, ext := range []string{parity.Ext, sign.Ext} {
+		if err := utils.RemoveIfExists(file + ext); err != nil {
+			slog.WarnContext(ctx, "⚠️ 删除失败", "file", filepath.Base(file)+ext, "error", err)
+		}
+	}
+	report.FromContext(ctx).AddPruned(file)
+	return true
+}
@@ -1,45 +1,61 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/selection"
 	"github.com/xg4/vaultwarden-backup/internal/utils"
 )
 
 // CopyTask 文件/目录复制任务
 type CopyTask struct {
-	Path string // 要备份的文件或目录相对路径
+	Path     string              // 文件或目录在归档中的相对路径
+	Src      string              // 实际的源路径，为空时使用 DataDir/Path
+	Selector *selection.Selector // INCLUDE/EXCLUDE 规则，为空时复制全部内容
 }
 
 func (c *CopyTask) Name() string { return "备份" + c.Path }
 
 // Run 执行文件或目录的复制备份
-func (c *CopyTask) Run(cfg *config.Config) error {
-	return copyItem(cfg, c.Path)
+func (c *CopyTask) Run(ctx context.Context, cfg *config.Config) error {
+	src := c.Src
+	if src == "" {
+		src = filepath.Join(cfg.DataDir, c.Path)
+	}
+	return copyItem(ctx, cfg, c.Path, src, c.Selector)
 }
 
 // copyItem 复制指定的文件或目录到备份临时目录
-func copyItem(cfg *config.Config, name string) error {
-	src := filepath.Join(cfg.DataDir, name)
+func copyItem(ctx context.Context, cfg *config.Config, name, src string, sel *selection.Selector) error {
 	dest := filepath.Join(cfg.TmpDir, name)
 
 	// 检查源文件/目录是否存在
 	fileInfo, err := os.Stat(src)
 	if os.IsNotExist(err) {
-		slog.Debug("🤔 跳过不存在的文件", "path", name)
+		slog.DebugContext(ctx, "🤔 跳过不存在的文件", "path", name)
 		return nil // 文件不存在时不报错，只是跳过
 	}
 
-	slog.Debug(fmt.Sprintf("📦 备份 %s -> %s", src, dest))
+	if sel != nil && !selected(sel, name, fileInfo.IsDir()) {
+		slog.DebugContext(ctx, "⏭️ 跳过未选中的文件", "path", name)
+		return nil
+	}
+
+	slog.DebugContext(ctx, "📦 备份文件", "src", src, "dest", dest)
 
 	// 根据文件类型选择复制方式
 	if fileInfo.IsDir() {
+		var filter func(string, os.FileInfo) bool
+		if sel != nil {
+			filter = sel.Filter(name)
+		}
 		// 复制整个目录
-		if err := utils.CopyDir(src, dest); err != nil {
+		if err := utils.CopyDir(src, dest, filter); err != nil {
 			return fmt.Errorf("%s 备份失败: %w", name, err)
 		}
 	} else {
@@ -50,3 +66,11 @@ func copyItem(cfg *config.Config, name string) error {
 	}
 	return nil
 }
+
+// selected 判断顶层文件或目录是否被 INCLUDE/EXCLUDE 规则选中
+func selected(sel *selection.Selector, name string, isDir bool) bool {
+	if isDir {
+		return sel.Dir(name)
+	}
+	return sel.File(name)
+}
@@ -1,38 +1,46 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"log/slog"
 
 	"github.com/xg4/vaultwarden-backup/internal/config"
-	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/internal/database"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
 )
 
-// DatabaseTask SQLite 数据库备份任务
-type DatabaseTask struct{}
+// DatabaseTask 数据库备份任务，根据 DATABASE_URL 自动选择 SQLite、PostgreSQL 或 MySQL/MariaDB
+type DatabaseTask struct {
+	URL secret.Value // 解析后的 DATABASE_URL，为空时使用 cfg.DatabaseURL
+}
 
 func (DatabaseTask) Name() string { return "备份数据库" }
 
-// Run 备份 SQLite 数据库文件并验证完整性
-func (DatabaseTask) Run(cfg *config.Config) error {
-	srcDB := filepath.Join(cfg.DataDir, "db.sqlite3")
-	destDB := filepath.Join(cfg.TmpDir, "db.sqlite3")
-
-	// 检查源数据库文件是否存在
-	if _, err := os.Stat(srcDB); os.IsNotExist(err) {
-		return fmt.Errorf("❌ 数据库文件 %s 不存在", srcDB)
+// Run 将数据库一致性地导出到临时备份目录，并记录数据库类型和版本
+func (t DatabaseTask) Run(ctx context.Context, cfg *config.Config) error {
+	url := t.URL
+	if url.IsZero() {
+		url = cfg.DatabaseURL
 	}
+	backend := database.New(url.Reveal(), cfg.DataDir)
+	slog.DebugContext(ctx, "🗄️ 导出数据库", "engine", backend.Engine())
 
-	// 使用 sqlite3 命令进行数据库备份
-	if err := utils.BackupSQLite(srcDB, destDB); err != nil {
+	if err := backend.Dump(cfg.TmpDir); err != nil {
 		return err
 	}
 
-	// 验证备份文件的完整性
-	if err := utils.CheckSQLiteIntegrity(destDB); err != nil {
-		return err
+	version, err := backend.Version()
+	if err != nil {
+		return fmt.Errorf("获取数据库版本失败: %w", err)
 	}
-
-	return nil
+	slog.DebugContext(ctx, "🗄️ 数据库信息", "engine", backend.Engine(), "version", version)
+	report.FromContext(ctx).SetDatabase(string(backend.Engine()), version)
+
+	return database.WriteInfo(cfg.TmpDir, database.Info{
+		Engine:  backend.Engine(),
+		Version: version,
+		Dump:    database.DumpFile(backend.Engine()),
+	})
 }
@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/pkg/parity"
+)
+
+// ParityTask 为归档生成 Reed-Solomon 纠错数据（归档旁的 .par 文件），归档部分损坏时可用 vaultr repair 修复
+type ParityTask struct {
+	Timestamp string
+}
+
+func (c *ParityTask) Name() string { return "生成纠错数据" }
+
+func (c *ParityTask) Run(ctx context.Context, cfg *config.Config) error {
+	archiveFile := filepath.Join(cfg.BackupDir, archive.FileName(cfg.BackupName, c.Timestamp, cfg.Compression))
+
+	if err := parity.Create(archiveFile, cfg.ParityPercent); err != nil {
+		utils.RemoveIfExists(archiveFile + parity.Ext)
+		return fmt.Errorf("生成纠错数据失败: %w", err)
+	}
+
+	if info, err := os.Stat(archiveFile + parity.Ext); err == nil {
+		slog.DebugContext(ctx, "🛟 纠错数据已生成", "file", filepath.Base(archiveFile)+parity.Ext, "size", utils.FormatBytes(info.Size()), "percent", cfg.ParityPercent)
+	}
+	return nil
+}
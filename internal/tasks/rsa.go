@@ -1,35 +1,44 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"strings"
 
 	"github.com/xg4/vaultwarden-backup/internal/config"
 	"github.com/xg4/vaultwarden-backup/internal/utils"
 )
 
 // RSATask RSA 密钥文件备份任务
-type RSATask struct{}
+type RSATask struct {
+	Prefix string // RSA_KEY_FILENAME 解析后的密钥文件前缀，为空时使用 DataDir/rsa_key
+}
 
 func (RSATask) Name() string { return "备份RSA密钥" }
 
 // Run 备份所有 RSA 密钥相关文件
-// 包括 rsa_key*, rsa_key.pem, rsa_key.pub.pem 等文件
-func (RSATask) Run(cfg *config.Config) error {
+// 包括 rsa_key*, rsa_key.pem, rsa_key.pub.pem 等文件，归档中统一以 rsa_key 为前缀
+func (t RSATask) Run(ctx context.Context, cfg *config.Config) error {
+	prefix := t.Prefix
+	if prefix == "" {
+		prefix = filepath.Join(cfg.DataDir, "rsa_key")
+	}
+
 	// 查找所有 RSA 密钥文件
-	matches, err := filepath.Glob(filepath.Join(cfg.DataDir, "rsa_key*"))
+	matches, err := filepath.Glob(prefix + "*")
 	if err != nil {
 		return fmt.Errorf("🔍 查找RSA密钥失败: %w", err)
 	}
 	if len(matches) == 0 {
-		return fmt.Errorf("🔑 RSA密钥不存在")
+		return fmt.Errorf("🔑 RSA密钥不存在: %s*", prefix)
 	}
 
 	// 逐个复制密钥文件
 	for _, file := range matches {
-		slog.Debug("✨ 找到 rsa_key* 文件", "file", filepath.Base(file))
-		destFile := filepath.Join(cfg.TmpDir, filepath.Base(file))
+		slog.DebugContext(ctx, "✨ 找到 rsa_key* 文件", "file", filepath.Base(file))
+		destFile := filepath.Join(cfg.TmpDir, "rsa_key"+strings.TrimPrefix(file, prefix))
 		if err := utils.CopyFile(file, destFile); err != nil {
 			return fmt.Errorf("🔒 备份RSA密钥 %s 失败: %w", file, err)
 		}
@@ -0,0 +1,38 @@
+package tasks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/xg4/vaultwarden-backup/internal/archive"
+	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
+	"github.com/xg4/vaultwarden-backup/pkg/sign"
+)
+
+// SignTask 用 Ed25519 私钥为归档生成分离签名（归档旁的 .sig 文件），vaultr 可用公钥确认归档未被替换
+type SignTask struct {
+	Timestamp string
+}
+
+func (c *SignTask) Name() string { return "签名归档" }
+
+func (c *SignTask) Run(ctx context.Context, cfg *config.Config) error {
+	archiveFile := filepath.Join(cfg.BackupDir, archive.FileName(cfg.BackupName, c.Timestamp, cfg.Compression))
+
+	// 每次运行重新读取私钥，轮换密钥后无需重启
+	key, err := sign.LoadPrivateKey(cfg.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("读取签名私钥失败: %w", err)
+	}
+	if err := sign.Sign(archiveFile, key); err != nil {
+		utils.RemoveIfExists(archiveFile + sign.Ext)
+		return fmt.Errorf("签名归档失败: %w", err)
+	}
+
+	slog.DebugContext(ctx, "🔏 归档已签名", "file", filepath.Base(archiveFile)+sign.Ext, "key", sign.KeyID(key.Public().(ed25519.PublicKey)))
+	return nil
+}
@@ -1,38 +1,38 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 
 	"github.com/xg4/vaultwarden-backup/internal/config"
+	"github.com/xg4/vaultwarden-backup/internal/report"
+	"github.com/xg4/vaultwarden-backup/internal/selection"
+	"github.com/xg4/vaultwarden-backup/internal/utils"
 	"golang.org/x/sys/unix"
 )
 
 // CheckDiskSpace 磁盘空间检查任务
-type CheckDiskSpace struct{}
+type CheckDiskSpace struct {
+	Items    []selection.Item    // 可备份的条目，为空时统计整个数据目录
+	Selector *selection.Selector // INCLUDE/EXCLUDE 规则
+	Extra    []string            // 额外计入的文件，如 SQLite 数据库和 RSA 密钥
+}
 
 func (CheckDiskSpace) Name() string {
 	return "检查磁盘空间"
 }
 
 // Run 检查备份目录是否有足够的磁盘空间
-// 需要的空间 = 数据目录大小 * 2（考虑压缩和临时文件）
-func (CheckDiskSpace) Run(cfg *config.Config) error {
-	src, dst := cfg.DataDir, cfg.BackupDir
+// 需要的空间 = 待备份数据大小 * 2（临时目录中的副本，加上最坏情况下不可压缩的归档）
+// + 启用纠错时的纠错数据（按归档大小的 PARITY_PERCENT 估算）
+func (c CheckDiskSpace) Run(ctx context.Context, cfg *config.Config) error {
+	dst := cfg.BackupDir
 
-	// 计算数据目录总大小
-	var dataSize int64
-	err := filepath.Walk(src, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			dataSize += info.Size()
-		}
-		return nil
-	})
+	// 计算待备份数据的总大小
+	dataSize, err := c.dataSize(cfg)
 	if err != nil {
 		return fmt.Errorf("计算数据目录大小时出错: %w", err)
 	}
@@ -44,27 +44,49 @@ func (CheckDiskSpace) Run(cfg *config.Config) error {
 	}
 
 	availableSpace := int64(stat.Bavail) * int64(stat.Bsize) // 修复类型转换问题
-	requiredSpace := dataSize * 2                            // 预留2倍空间用于压缩和临时文件
+	requiredSpace := dataSize * 2
+	if cfg.ParityPercent > 0 {
+		requiredSpace += dataSize * int64(cfg.ParityPercent) / 100
+	}
+	report.FromContext(ctx).SetDiskFree(availableSpace)
 
-	slog.Debug("💾 磁盘空间检查", "required", formatBytes(requiredSpace), "available", formatBytes(availableSpace))
+	slog.DebugContext(ctx, "💾 磁盘空间检查", "required", utils.FormatBytes(requiredSpace), "available", utils.FormatBytes(availableSpace))
 
 	if availableSpace < requiredSpace {
-		return fmt.Errorf("磁盘空间不足: 需要 %s, 可用 %s", formatBytes(requiredSpace), formatBytes(availableSpace))
+		return fmt.Errorf("磁盘空间不足: 需要 %s, 可用 %s", utils.FormatBytes(requiredSpace), utils.FormatBytes(availableSpace))
 	}
 
 	return nil
 }
 
-// formatBytes 将字节数格式化为人类可读的格式（B, KB, MB, GB, TB, PB, EB）
-func formatBytes(b int64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
+// dataSize 统计被选中文件的总大小
+func (c CheckDiskSpace) dataSize(cfg *config.Config) (int64, error) {
+	var size int64
+	add := func(_, _ string, info os.FileInfo) error {
+		size += info.Size()
+		return nil
 	}
-	div, exp := int64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+
+	if c.Selector == nil {
+		err := filepath.Walk(cfg.DataDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return add("", path, info)
+		})
+		return size, err
+	}
+
+	if err := c.Selector.Walk(c.Items, add); err != nil {
+		return 0, err
+	}
+	for _, file := range c.Extra {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
 	}
-	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+	return size, nil
 }
@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -14,7 +15,7 @@ func (CreateBackupTmpDir) Name() string {
 	return "创建临时目录"
 }
 
-func (CreateBackupTmpDir) Run(cfg *config.Config) error {
+func (CreateBackupTmpDir) Run(ctx context.Context, cfg *config.Config) error {
 	// 安全地清理并创建备份目录
 	if err := utils.RemoveIfExists(cfg.TmpDir); err != nil {
 		return fmt.Errorf("🗑️ 无法清理临时备份目录: %s, 错误: %v", cfg.TmpDir, err)
@@ -31,7 +32,7 @@ func (CheckDataDir) Name() string {
 	return "检查数据目录"
 }
 
-func (CheckDataDir) Run(cfg *config.Config) error {
+func (CheckDataDir) Run(ctx context.Context, cfg *config.Config) error {
 	info, err := os.Stat(cfg.DataDir)
 	if os.IsNotExist(err) {
 		return fmt.Errorf("❌ 数据目录不存在: %s", cfg.DataDir)
@@ -1,28 +1,132 @@
 package utils
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"os/exec"
+	"net/url"
+	"path/filepath"
 	"strings"
+
+	"modernc.org/sqlite"
 )
 
-// BackupSQLite 使用sqlite3命令备份数据库
+// sqliteBackuper 纯 Go SQLite 驱动连接提供的在线备份接口
+type sqliteBackuper interface {
+	NewBackup(dstUri string) (*sqlite.Backup, error)
+}
+
+// BackupSQLite 使用 SQLite 在线备份 API 备份数据库，无需 sqlite3 命令
 func BackupSQLite(srcPath, destPath string) error {
-	cmd := exec.Command("sqlite3", srcPath, fmt.Sprintf(".backup '%s'", destPath))
-	return cmd.Run()
+	src, err := sqliteURI(srcPath)
+	if err != nil {
+		return err
+	}
+	dest, err := sqliteURI(destPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", src+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return fmt.Errorf("打开数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("连接数据库失败: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		b, ok := driverConn.(sqliteBackuper)
+		if !ok {
+			return fmt.Errorf("SQLite 驱动不支持在线备份")
+		}
+
+		backup, err := b.NewBackup(dest)
+		if err != nil {
+			return fmt.Errorf("初始化数据库备份失败: %w", err)
+		}
+
+		// 一次性复制所有页面，保证得到一致的快照
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return fmt.Errorf("数据库备份失败: %w", err)
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("完成数据库备份失败: %w", err)
+		}
+		return nil
+	})
 }
 
 // CheckSQLiteIntegrity 检查SQLite数据库完整性
 func CheckSQLiteIntegrity(dbPath string) error {
-	cmd := exec.Command("sqlite3", dbPath, "PRAGMA integrity_check;")
-	output, err := cmd.CombinedOutput()
+	dsn, err := sqliteURI(dbPath)
 	if err != nil {
 		return err
 	}
 
-	result := strings.TrimSpace(string(output))
+	db, err := sql.Open("sqlite", dsn+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("打开数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("执行完整性检查失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("读取完整性检查结果失败: %w", err)
+		}
+		results = append(results, line)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取完整性检查结果失败: %w", err)
+	}
+
+	result := strings.Join(results, "\n")
 	if result != "ok" {
 		return fmt.Errorf("数据完整性检查发现问题:\n%s", result)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// SQLiteVersion 返回 SQLite 库版本
+func SQLiteVersion(dbPath string) (string, error) {
+	dsn, err := sqliteURI(dbPath)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := sql.Open("sqlite", dsn+"?mode=ro")
+	if err != nil {
+		return "", fmt.Errorf("打开数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return "", fmt.Errorf("查询 SQLite 版本失败: %w", err)
+	}
+	return version, nil
+}
+
+// sqliteURI 将文件路径转换为 SQLite URI，路径中的特殊字符会被正确转义
+func sqliteURI(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("解析数据库路径失败: %w", err)
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	return u.String(), nil
+}
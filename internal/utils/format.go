@@ -0,0 +1,17 @@
+package utils
+
+import "fmt"
+
+// FormatBytes 将字节数格式化为人类可读的格式（B, KB, MB, GB, TB, PB, EB）
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 )
 
 // EnsureDir 确保目录存在，如果不存在则创建
@@ -27,48 +26,18 @@ func RemoveIfExists(path string) error {
 	return os.RemoveAll(path)
 }
 
-// HashDir 计算目录中所有文件内容的 SHA256 哈希值
-func HashDir(dir string) (string, error) {
-	h := sha256.New()
-	var paths []string
-
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			relPath, err := filepath.Rel(dir, path)
-			if err != nil {
-				return err
-			}
-			paths = append(paths, relPath)
-		}
-		return nil
-	})
+// HashFile 计算文件内容的 SHA256 哈希值
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
+	defer f.Close()
 
-	sort.Strings(paths)
-
-	for _, relPath := range paths {
-		// 将文件名写入哈希
-		if _, err := h.Write([]byte(relPath)); err != nil {
-			return "", err
-		}
-
-		// 将文件内容写入哈希
-		f, err := os.Open(filepath.Join(dir, relPath))
-		if err != nil {
-			return "", err
-		}
-		defer f.Close()
-
-		if _, err := io.Copy(h, f); err != nil {
-			return "", err
-		}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
 	}
-
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
@@ -89,7 +58,9 @@ func CopyFile(src, dst string) error {
 	return err
 }
 
-func CopyDir(src, dst string) error {
+// CopyDir 递归复制目录。filter 不为 nil 时只复制其返回 true 的文件，
+// 对目录返回 false 时跳过整个目录；rel 为相对于 src 的路径
+func CopyDir(src, dst string, filter func(rel string, info os.FileInfo) bool) error {
 	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -98,6 +69,12 @@ func CopyDir(src, dst string) error {
 		if err != nil {
 			return err
 		}
+		if filter != nil && !filter(relPath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		dstPath := filepath.Join(dst, relPath)
 
 		if info.IsDir() {
@@ -0,0 +1,259 @@
+package vaultwarden
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xg4/vaultwarden-backup/internal/database"
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+	"github.com/xg4/vaultwarden-backup/internal/selection"
+)
+
+// Layout Vaultwarden 实际使用的数据位置，路径均已映射到本容器中的 DataDir
+type Layout struct {
+	DataDir     string       // 本容器中看到的 Vaultwarden 数据目录
+	DatabaseURL secret.Value // 数据库地址，SQLite 时为数据库文件路径
+	Attachments string       // 附件目录
+	Sends       string       // Send 文件目录
+	IconCache   string       // 图标缓存目录
+	RSAKey      string       // RSA 密钥文件前缀（不含 .pem 后缀）
+}
+
+// LogValue 以结构化形式输出解析结果，非 SQLite 的数据库地址保持脱敏
+func (l *Layout) LogValue() slog.Value {
+	engine := database.Detect(l.DatabaseURL.Reveal())
+	db := l.DatabaseURL.String()
+	if engine == database.SQLite {
+		db = l.DatabaseURL.Reveal()
+	}
+	return slog.GroupValue(
+		slog.String("engine", string(engine)),
+		slog.String("database", db),
+		slog.String("rsa_key", l.RSAKey+"*"),
+		slog.String("attachments", l.Attachments),
+		slog.String("sends", l.Sends),
+		slog.String("icon_cache", l.IconCache),
+	)
+}
+
+// keys 影响数据位置的 Vaultwarden 配置项
+var keys = []string{
+	"DATA_FOLDER",
+	"DATABASE_URL",
+	"ATTACHMENTS_FOLDER",
+	"SENDS_FOLDER",
+	"ICON_CACHE_FOLDER",
+	"RSA_KEY_FILENAME",
+}
+
+// Discover 按 Vaultwarden 的优先级解析数据位置：
+// 默认值 < DataDir/.env < 进程环境变量 < DataDir/config.json。
+// databaseURL 为本进程通过 DATABASE_URL(_FILE) 读取到的值，视为环境变量。
+func Discover(dataDir string, databaseURL secret.Value) (*Layout, error) {
+	values := map[string]string{}
+
+	env, err := readDotEnv(filepath.Join(dataDir, ".env"))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range env {
+		values[k] = v
+	}
+
+	for _, key := range keys {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			values[key] = v
+		}
+	}
+	if !databaseURL.IsZero() {
+		values["DATABASE_URL"] = databaseURL.Reveal()
+	}
+
+	cfg, err := readConfigJSON(filepath.Join(dataDir, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cfg {
+		values[k] = v
+	}
+
+	r := resolver{dataDir: dataDir, dataFolder: values["DATA_FOLDER"]}
+	if r.dataFolder == "" {
+		r.dataFolder = "data"
+	}
+
+	layout := &Layout{
+		DataDir:     dataDir,
+		Attachments: r.resolve(values["ATTACHMENTS_FOLDER"], "attachments"),
+		Sends:       r.resolve(values["SENDS_FOLDER"], "sends"),
+		IconCache:   r.resolve(values["ICON_CACHE_FOLDER"], "icon_cache"),
+		RSAKey:      r.resolve(values["RSA_KEY_FILENAME"], "rsa_key"),
+	}
+
+	// SQLite 的 DATABASE_URL 是文件路径，同样需要映射；其他数据库原样保留
+	url := values["DATABASE_URL"]
+	if url == "" || !strings.Contains(url, "://") || strings.HasPrefix(url, "sqlite://") {
+		url = r.resolve(strings.TrimPrefix(url, "sqlite://"), "db.sqlite3")
+	}
+	layout.DatabaseURL = secret.Value(url)
+
+	return layout, nil
+}
+
+// resolver 将 Vaultwarden 容器中的路径映射到本容器中的路径
+type resolver struct {
+	dataDir    string // 本容器中的数据目录
+	dataFolder string // Vaultwarden 的 DATA_FOLDER
+}
+
+// resolve 位于 DATA_FOLDER 之下的路径映射到 DataDir，其余绝对路径保持不变，
+// 相对路径按相对于 DataDir 处理；value 为空时使用 DataDir/fallback
+func (r resolver) resolve(value, fallback string) string {
+	if value == "" {
+		return filepath.Join(r.dataDir, fallback)
+	}
+
+	clean := filepath.Clean(value)
+	rel := strings.TrimPrefix(clean, "/")
+	root := strings.TrimPrefix(filepath.Clean(r.dataFolder), "/")
+
+	switch {
+	case rel == root:
+		return r.dataDir
+	case strings.HasPrefix(rel, root+"/"):
+		return filepath.Join(r.dataDir, strings.TrimPrefix(rel, root+"/"))
+	case filepath.IsAbs(clean):
+		return clean
+	default:
+		return filepath.Join(r.dataDir, clean)
+	}
+}
+
+// readDotEnv 读取 .env 文件中与数据位置相关的配置，文件不存在时返回空
+func readDotEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if isKnownKey(key) && value != "" {
+			values[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	return values, nil
+}
+
+// readConfigJSON 读取管理页面保存的 config.json，键名为小写形式，文件不存在时返回空
+func readConfigJSON(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for _, key := range keys {
+		if v, ok := raw[strings.ToLower(key)].(string); ok && v != "" {
+			values[key] = v
+		}
+	}
+	return values, nil
+}
+
+// isKnownKey 判断是否为影响数据位置的配置项
+func isKnownKey(key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Items 列出可备份的顶层条目：附件、Send、图标缓存按解析后的位置映射到固定名称，
+// 数据目录中的其他条目原样列出。数据库和 RSA 密钥由专门的任务处理，skip 中的路径
+// （如位于数据目录内的备份目录）以及恢复工具留下的临时目录也不会列出
+func (l *Layout) Items(skip ...string) ([]selection.Item, error) {
+	items := []selection.Item{
+		{Path: "attachments", Src: l.Attachments},
+		{Path: "sends", Src: l.Sends},
+		{Path: "icon_cache", Src: l.IconCache},
+	}
+
+	ignored := map[string]bool{}
+	for _, item := range items {
+		ignored[absPath(item.Src)] = true
+		ignored[absPath(filepath.Join(l.DataDir, item.Path))] = true
+	}
+	for _, p := range skip {
+		ignored[absPath(p)] = true
+	}
+	if url := l.DatabaseURL.Reveal(); database.Detect(url) == database.SQLite {
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			ignored[absPath(url+suffix)] = true
+		}
+	}
+	rsaPrefix := absPath(l.RSAKey)
+
+	entries, err := os.ReadDir(l.DataDir)
+	if os.IsNotExist(err) {
+		return items, nil // 由 CheckDataDir 任务报告数据目录不存在
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取数据目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		src := filepath.Join(l.DataDir, entry.Name())
+		abs := absPath(src)
+		if ignored[abs] || strings.HasPrefix(abs, rsaPrefix) || strings.HasPrefix(entry.Name(), ".vaultr_") {
+			continue
+		}
+		items = append(items, selection.Item{Path: entry.Name(), Src: src})
+	}
+	return items, nil
+}
+
+// absPath 返回用于比较的绝对路径，失败时返回清理后的原路径
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
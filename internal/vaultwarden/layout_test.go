@@ -0,0 +1,244 @@
+package vaultwarden
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xg4/vaultwarden-backup/internal/secret"
+)
+
+// clearEnv 清空影响数据位置的环境变量，测试结束后自动恢复
+func clearEnv(t *testing.T) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+}
+
+// writeFile 在 dir 中写入测试文件
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverDefaults(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+
+	l, err := Discover(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Layout{
+		DataDir:     dir,
+		DatabaseURL: secret.Value(filepath.Join(dir, "db.sqlite3")),
+		Attachments: filepath.Join(dir, "attachments"),
+		Sends:       filepath.Join(dir, "sends"),
+		IconCache:   filepath.Join(dir, "icon_cache"),
+		RSAKey:      filepath.Join(dir, "rsa_key"),
+	}
+	if *l != want {
+		t.Errorf("Discover = %+v, want %+v", *l, want)
+	}
+}
+
+func TestDiscoverPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		dotEnv string
+		env    map[string]string
+		config string
+		want   string // 解析后的附件目录，相对于 DataDir
+	}{
+		{
+			name:   "dotenv",
+			dotEnv: "# comment\nexport ATTACHMENTS_FOLDER=\"/data/from-dotenv\"\nUNRELATED=/x\n",
+			want:   "from-dotenv",
+		},
+		{
+			name:   "env over dotenv",
+			dotEnv: "ATTACHMENTS_FOLDER=/data/from-dotenv\n",
+			env:    map[string]string{"ATTACHMENTS_FOLDER": "/data/from-env"},
+			want:   "from-env",
+		},
+		{
+			name:   "empty env keeps dotenv",
+			dotEnv: "ATTACHMENTS_FOLDER='/data/from-dotenv'\n",
+			env:    map[string]string{"ATTACHMENTS_FOLDER": ""},
+			want:   "from-dotenv",
+		},
+		{
+			name:   "config over env",
+			dotEnv: "ATTACHMENTS_FOLDER=/data/from-dotenv\n",
+			env:    map[string]string{"ATTACHMENTS_FOLDER": "/data/from-env"},
+			config: `{"attachments_folder": "/data/from-config"}`,
+			want:   "from-config",
+		},
+		{
+			name:   "empty config value ignored",
+			env:    map[string]string{"ATTACHMENTS_FOLDER": "/data/from-env"},
+			config: `{"attachments_folder": "", "signups_allowed": false}`,
+			want:   "from-env",
+		},
+		{
+			name:   "DATA_FOLDER from dotenv",
+			dotEnv: "DATA_FOLDER=/vw\nATTACHMENTS_FOLDER=/vw/files\n",
+			want:   "files",
+		},
+		{
+			name:   "DATA_FOLDER from config",
+			env:    map[string]string{"DATA_FOLDER": "/data", "ATTACHMENTS_FOLDER": "/srv/vw/files"},
+			config: `{"data_folder": "/srv/vw"}`,
+			want:   "files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			dir := t.TempDir()
+			if tt.dotEnv != "" {
+				writeFile(t, dir, ".env", tt.dotEnv)
+			}
+			if tt.config != "" {
+				writeFile(t, dir, "config.json", tt.config)
+			}
+
+			l, err := Discover(dir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); l.Attachments != want {
+				t.Errorf("Attachments = %s, want %s", l.Attachments, want)
+			}
+		})
+	}
+}
+
+func TestDiscoverPaths(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DATA_FOLDER", "/vw-data")
+	t.Setenv("ATTACHMENTS_FOLDER", "files/attachments") // 相对路径按 DataDir 解析
+	t.Setenv("SENDS_FOLDER", "/vw-data")                // 等于 DATA_FOLDER
+	t.Setenv("ICON_CACHE_FOLDER", "/var/cache/icons")   // DATA_FOLDER 之外的绝对路径保持不变
+	t.Setenv("RSA_KEY_FILENAME", "/vw-data/keys/rsa")
+	dir := t.TempDir()
+
+	l, err := Discover(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string][2]string{
+		"Attachments": {l.Attachments, filepath.Join(dir, "files", "attachments")},
+		"Sends":       {l.Sends, dir},
+		"IconCache":   {l.IconCache, "/var/cache/icons"},
+		"RSAKey":      {l.RSAKey, filepath.Join(dir, "keys", "rsa")},
+		"DatabaseURL": {l.DatabaseURL.Reveal(), filepath.Join(dir, "db.sqlite3")},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s = %s, want %s", name, c[0], c[1])
+		}
+	}
+}
+
+func TestDiscoverDatabaseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		arg    secret.Value
+		config string
+		want   string // {dir} 表示 DataDir
+	}{
+		{name: "sqlite path", env: "/data/vault.db", want: "{dir}/vault.db"},
+		{name: "sqlite scheme", env: "sqlite:///data/vault.db", want: "{dir}/vault.db"},
+		{name: "relative sqlite path", env: "db/vault.db", want: "{dir}/db/vault.db"},
+		{name: "postgres", env: "postgresql://vw:pw@db/vw", want: "postgresql://vw:pw@db/vw"},
+		{name: "argument over env", env: "/data/vault.db", arg: "mysql://vw:pw@db/vw", want: "mysql://vw:pw@db/vw"},
+		{
+			name:   "config over argument",
+			arg:    "mysql://vw:pw@db/vw",
+			config: `{"database_url": "postgresql://vw:pw@pg/vw"}`,
+			want:   "postgresql://vw:pw@pg/vw",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("DATABASE_URL", tt.env)
+			dir := t.TempDir()
+			if tt.config != "" {
+				writeFile(t, dir, "config.json", tt.config)
+			}
+
+			l, err := Discover(dir, tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if rest, ok := strings.CutPrefix(want, "{dir}"); ok {
+				want = filepath.Join(dir, rest)
+			}
+			if got := l.DatabaseURL.Reveal(); got != want {
+				t.Errorf("DatabaseURL = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDiscoverInvalidConfig(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "config.json", "{not json")
+
+	if _, err := Discover(dir, ""); err == nil {
+		t.Error("Discover succeeded with a malformed config.json")
+	}
+}
+
+func TestItems(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	for _, name := range []string{"db.sqlite3", "db.sqlite3-wal", "rsa_key.pem", "rsa_key.pub.pem"} {
+		writeFile(t, dir, name, "x")
+	}
+	writeFile(t, dir, "config.json", "{}")
+	for _, name := range []string{"attachments", "backups", ".vaultr_rollback_20260101_120000", "custom"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := Discover(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := l.Items(filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, item := range items {
+		got[item.Path] = item.Src
+	}
+	want := map[string]string{
+		"attachments": filepath.Join(dir, "attachments"),
+		"sends":       filepath.Join(dir, "sends"),
+		"icon_cache":  filepath.Join(dir, "icon_cache"),
+		"config.json": filepath.Join(dir, "config.json"),
+		"custom":      filepath.Join(dir, "custom"),
+	}
+	if len(got) != len(want) {
+		t.Errorf("Items = %v, want %v", got, want)
+	}
+	for path, src := range want {
+		if got[path] != src {
+			t.Errorf("item %s = %q, want %q", path, got[path], src)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package version
+
+// Version 程序版本，构建时通过 -ldflags "-X github.com/xg4/vaultwarden-backup/internal/version.Version=..." 设置
+var Version = "dev"
+
+// String 返回带程序名称的版本，如 vaultwarden-backup 1.2.0
+func String() string {
+	return "vaultwarden-backup " + Version
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 
@@ -17,7 +18,13 @@ const (
 	pbkdf2Iter = 100_000 // PBKDF2 iterations
 )
 
+// ErrAuthentication is returned by DecryptStream when the GCM authentication tag does not
+// match. The password is wrong or the ciphertext was altered; the two cannot be told apart.
+var ErrAuthentication = errors.New("message authentication failed")
+
 // EncryptStream encrypts data from reader and writes to writer using AES-256-GCM.
+// The output is a single GCM message, so the whole plaintext and ciphertext are held in
+// memory: peak usage is about twice the size of the data.
 func EncryptStream(reader io.Reader, writer io.Writer, password string) error {
 	salt := make([]byte, saltSize)
 	if _, err := rand.Read(salt); err != nil {
@@ -66,6 +73,8 @@ func EncryptStream(reader io.Reader, writer io.Writer, password string) error {
 }
 
 // DecryptStream decrypts data from reader and writes to writer.
+// The ciphertext is authenticated as a whole before any plaintext is written, so the
+// whole message is held in memory: peak usage is about twice the size of the archive.
 func DecryptStream(reader io.Reader, writer io.Writer, password string) error {
 	salt := make([]byte, saltSize)
 	if _, err := io.ReadFull(reader, salt); err != nil {
@@ -98,7 +107,7 @@ func DecryptStream(reader io.Reader, writer io.Writer, password string) error {
 	// Decrypt the data.
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt data: %w", err)
+		return fmt.Errorf("failed to decrypt data: %w", ErrAuthentication)
 	}
 
 	// Write the plaintext to the writer.
@@ -0,0 +1,428 @@
+// Package parity creates Reed-Solomon parity sidecar files for archives and uses
+// them to reconstruct damaged blocks.
+//
+// The archive is split into fixed-size blocks. Blocks are interleaved into stripes
+// (block i belongs to stripe i % stripes), so that a contiguous run of damaged
+// bytes is spread over many stripes. Each stripe has DataShards data blocks and
+// ParityShards parity blocks. The sidecar stores the SHA-256 of every block, which
+// turns damaged blocks into erasures: a stripe can be rebuilt as long as no more
+// than ParityShards of its blocks are damaged.
+//
+// Sidecar layout:
+//
+//	magic | uint32 header length | header JSON | data block hashes | parity block hashes | SHA-256 of all preceding bytes | parity blocks
+package parity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// Ext is appended to the archive file name to form the sidecar file name.
+const Ext = ".par"
+
+const (
+	magic         = "VWBPAR01"
+	format        = 1
+	maxDataShards = 64
+	minBlockSize  = 4 << 10
+	maxBlockSize  = 1 << 20
+	targetBlocks  = 4096
+)
+
+// ErrUnrecoverable is returned when more blocks are damaged than the parity data can rebuild.
+var ErrUnrecoverable = errors.New("too many damaged blocks to repair")
+
+// header describes the protected file and the parity layout.
+type header struct {
+	Format       int    `json:"format"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+	BlockSize    int    `json:"block_size"`
+	DataShards   int    `json:"data_shards"`
+	ParityShards int    `json:"parity_shards"`
+	Stripes      int    `json:"stripes"`
+}
+
+// blocks returns the number of data blocks.
+func (h *header) blocks() int {
+	return int((h.Size + int64(h.BlockSize) - 1) / int64(h.BlockSize))
+}
+
+// Result reports the state of an archive checked against its sidecar.
+type Result struct {
+	Blocks   int  // number of data blocks
+	Damaged  int  // data blocks that did not match their hash
+	Repaired int  // damaged blocks that were rebuilt
+	Resized  bool // the archive had the wrong length
+}
+
+// OK reports whether the archive matched the sidecar.
+func (r *Result) OK() bool {
+	return r.Damaged == 0 && !r.Resized
+}
+
+// Create writes the sidecar for file. percent is the minimum amount of parity data relative
+// to the archive size. Every stripe gets the same number of whole parity blocks, at least one,
+// so the sidecar is slightly larger than percent, and noticeably larger for archives of only
+// a few blocks.
+func Create(file string, percent int) error {
+	if percent <= 0 || percent > 100 {
+		return fmt.Errorf("invalid parity percentage %d, must be between 1 and 100", percent)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("cannot protect an empty file")
+	}
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return fmt.Errorf("failed to hash archive: %w", err)
+	}
+
+	h := newHeader(info.Size(), percent)
+	h.SHA256 = hex.EncodeToString(sum.Sum(nil))
+
+	enc, err := reedsolomon.New(h.DataShards, h.ParityShards)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+Ext+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	n := h.blocks()
+	dataHashes := make([]byte, n*sha256.Size)
+	parityHashes := make([]byte, h.Stripes*h.ParityShards*sha256.Size)
+	// The header does not change during encoding, so the prefix length is known up front.
+	prefix, err := encodePrefix(h, dataHashes, parityHashes)
+	if err != nil {
+		return err
+	}
+	parityOffset := int64(len(prefix) + sha256.Size)
+
+	shards := make([][]byte, h.DataShards+h.ParityShards)
+	for i := range shards {
+		shards[i] = make([]byte, h.BlockSize)
+	}
+	for s := 0; s < h.Stripes; s++ {
+		for r := 0; r < h.DataShards; r++ {
+			i := s + r*h.Stripes
+			if i >= n {
+				clear(shards[r])
+				continue
+			}
+			if err := readBlock(f, h, i, shards[r]); err != nil {
+				return err
+			}
+			hash := sha256.Sum256(shards[r])
+			copy(dataHashes[i*sha256.Size:], hash[:])
+		}
+		if err := enc.Encode(shards); err != nil {
+			return fmt.Errorf("failed to encode parity: %w", err)
+		}
+		for j := 0; j < h.ParityShards; j++ {
+			p := s*h.ParityShards + j
+			hash := sha256.Sum256(shards[h.DataShards+j])
+			copy(parityHashes[p*sha256.Size:], hash[:])
+			if _, err := out.WriteAt(shards[h.DataShards+j], parityOffset+int64(p)*int64(h.BlockSize)); err != nil {
+				return fmt.Errorf("failed to write parity: %w", err)
+			}
+		}
+	}
+
+	// The hash tables are only complete after encoding, so the prefix is written last.
+	prefix, err = encodePrefix(h, dataHashes, parityHashes)
+	if err != nil {
+		return err
+	}
+	check := sha256.Sum256(prefix)
+	if _, err := out.WriteAt(append(prefix, check[:]...), 0); err != nil {
+		return fmt.Errorf("failed to write parity header: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), file+Ext)
+}
+
+// Check compares file with its sidecar and reports damaged blocks without modifying anything.
+// It returns ErrUnrecoverable when the damage exceeds what the parity data can rebuild.
+func Check(file string) (*Result, error) {
+	return repair(file, false)
+}
+
+// Repair rebuilds the damaged blocks of file from its sidecar and replaces the file once the
+// result matches the SHA-256 recorded when the sidecar was created.
+func Repair(file string) (*Result, error) {
+	return repair(file, true)
+}
+
+func repair(file string, write bool) (*Result, error) {
+	p, err := os.Open(file + Ext)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+
+	h, dataHashes, parityHashes, parityOffset, err := decodePrefix(p)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := reedsolomon.New(h.DataShards, h.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	n := h.blocks()
+	result := &Result{Blocks: n, Resized: info.Size() != h.Size}
+	fixes := map[int][]byte{}
+	unrecoverable := false
+
+	shards := make([][]byte, h.DataShards+h.ParityShards)
+	for s := 0; s < h.Stripes; s++ {
+		var damaged []int // shard indexes of damaged data blocks
+		for r := 0; r < h.DataShards; r++ {
+			shards[r] = make([]byte, h.BlockSize)
+			i := s + r*h.Stripes
+			if i >= n {
+				continue
+			}
+			if err := readBlock(f, h, i, shards[r]); err != nil {
+				return nil, err
+			}
+			if !matches(shards[r], dataHashes, i) {
+				shards[r] = nil
+				damaged = append(damaged, r)
+			}
+		}
+		result.Damaged += len(damaged)
+		if len(damaged) == 0 {
+			continue
+		}
+
+		for j := 0; j < h.ParityShards; j++ {
+			k := s*h.ParityShards + j
+			buf := make([]byte, h.BlockSize)
+			if _, err := p.ReadAt(buf, parityOffset+int64(k)*int64(h.BlockSize)); err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			shards[h.DataShards+j] = nil
+			if matches(buf, parityHashes, k) {
+				shards[h.DataShards+j] = buf
+			}
+		}
+
+		if err := enc.ReconstructData(shards); err != nil {
+			unrecoverable = true
+			continue
+		}
+		for _, r := range damaged {
+			i := s + r*h.Stripes
+			if !matches(shards[r], dataHashes, i) {
+				unrecoverable = true
+				continue
+			}
+			fixes[i] = shards[r]
+			result.Repaired++
+		}
+	}
+
+	if unrecoverable {
+		return result, ErrUnrecoverable
+	}
+	if !write || result.OK() {
+		return result, nil
+	}
+	return result, rewrite(file, f, info.Mode(), h, fixes)
+}
+
+// rewrite writes a repaired copy of the archive next to it and replaces the original
+// after checking the whole-file SHA-256.
+func rewrite(file string, src *os.File, mode os.FileMode, h *header, fixes map[int][]byte) error {
+	out, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".repair.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if _, err := io.Copy(out, io.NewSectionReader(src, 0, h.Size)); err != nil {
+		return err
+	}
+	if err := out.Truncate(h.Size); err != nil {
+		return err
+	}
+	for i, block := range fixes {
+		off := int64(i) * int64(h.BlockSize)
+		if rest := h.Size - off; rest < int64(len(block)) {
+			block = block[:rest]
+		}
+		if _, err := out.WriteAt(block, off); err != nil {
+			return err
+		}
+	}
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, out); err != nil {
+		return err
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != h.SHA256 {
+		return fmt.Errorf("repaired archive does not match the recorded SHA-256")
+	}
+
+	if err := out.Chmod(mode); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), file)
+}
+
+// newHeader chooses the block size and stripe layout for a file of the given size.
+func newHeader(size int64, percent int) *header {
+	blockSize := minBlockSize
+	for blockSize < maxBlockSize && size > int64(blockSize)*targetBlocks {
+		blockSize *= 2
+	}
+
+	// Blocks are spread evenly over the stripes so that the padding in the last stripe stays
+	// below one block per stripe, and the parity is sized against the real number of blocks.
+	h := &header{Format: format, Size: size, BlockSize: blockSize}
+	n := h.blocks()
+	stripes := (n + maxDataShards - 1) / maxDataShards
+	h.DataShards = (n + stripes - 1) / stripes
+	h.Stripes = (n + h.DataShards - 1) / h.DataShards
+	h.ParityShards = max(1, (n*percent+100*h.Stripes-1)/(100*h.Stripes))
+	return h
+}
+
+// readBlock reads data block i into buf, zero-filling past the end of the file.
+func readBlock(f *os.File, h *header, i int, buf []byte) error {
+	clear(buf)
+	off := int64(i) * int64(h.BlockSize)
+	if off >= h.Size {
+		return nil
+	}
+	length := min(int64(h.BlockSize), h.Size-off)
+	if _, err := f.ReadAt(buf[:length], off); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read block %d: %w", i, err)
+	}
+	return nil
+}
+
+// matches reports whether block has the i-th hash in the table.
+func matches(block, hashes []byte, i int) bool {
+	sum := sha256.Sum256(block)
+	return bytes.Equal(sum[:], hashes[i*sha256.Size:(i+1)*sha256.Size])
+}
+
+// encodePrefix serializes everything before the prefix checksum.
+func encodePrefix(h *header, dataHashes, parityHashes []byte) ([]byte, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	buf.Write(dataHashes)
+	buf.Write(parityHashes)
+	return buf.Bytes(), nil
+}
+
+// decodePrefix reads and validates the header and hash tables, returning the offset of the parity blocks.
+func decodePrefix(r io.ReaderAt) (*header, []byte, []byte, int64, error) {
+	damaged := func(reason string) error {
+		return fmt.Errorf("parity file is damaged: %s", reason)
+	}
+
+	fixed := make([]byte, len(magic)+4)
+	if _, err := r.ReadAt(fixed, 0); err != nil {
+		return nil, nil, nil, 0, damaged("truncated header")
+	}
+	if string(fixed[:len(magic)]) != magic {
+		return nil, nil, nil, 0, fmt.Errorf("not a parity file")
+	}
+	length := binary.BigEndian.Uint32(fixed[len(magic):])
+	if length > 1<<20 {
+		return nil, nil, nil, 0, damaged("invalid header length")
+	}
+
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, int64(len(fixed))); err != nil {
+		return nil, nil, nil, 0, damaged("truncated header")
+	}
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, nil, nil, 0, damaged("invalid header")
+	}
+	if h.Format != format || h.Size <= 0 || h.BlockSize <= 0 || h.DataShards <= 0 || h.ParityShards <= 0 ||
+		h.DataShards+h.ParityShards > 256 || h.Stripes != (h.blocks()+h.DataShards-1)/h.DataShards {
+		return nil, nil, nil, 0, damaged("invalid header")
+	}
+
+	offset := int64(len(fixed)) + int64(length)
+	dataHashes := make([]byte, h.blocks()*sha256.Size)
+	parityHashes := make([]byte, h.Stripes*h.ParityShards*sha256.Size)
+	if _, err := r.ReadAt(dataHashes, offset); err != nil {
+		return nil, nil, nil, 0, damaged("truncated hash table")
+	}
+	offset += int64(len(dataHashes))
+	if _, err := r.ReadAt(parityHashes, offset); err != nil {
+		return nil, nil, nil, 0, damaged("truncated hash table")
+	}
+	offset += int64(len(parityHashes))
+
+	check := make([]byte, sha256.Size)
+	if _, err := r.ReadAt(check, offset); err != nil {
+		return nil, nil, nil, 0, damaged("truncated hash table")
+	}
+	prefix := append(fixed, data...)
+	prefix = append(prefix, dataHashes...)
+	prefix = append(prefix, parityHashes...)
+	if sum := sha256.Sum256(prefix); !bytes.Equal(sum[:], check) {
+		return nil, nil, nil, 0, damaged("checksum mismatch")
+	}
+	return &h, dataHashes, parityHashes, offset + sha256.Size, nil
+}
@@ -0,0 +1,155 @@
+package parity
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewHeaderParitySize(t *testing.T) {
+	tests := []struct {
+		size    int64
+		percent int
+	}{
+		{295 << 10, 10},
+		{64 << 10, 10},
+		{1 << 20, 5},
+		{300 << 20, 10},
+		{2 << 30, 1},
+		{(64<<10)*maxDataShards + 1, 10},
+	}
+	for _, tt := range tests {
+		h := newHeader(tt.size, tt.percent)
+		n := h.blocks()
+		if h.DataShards > maxDataShards || h.DataShards+h.ParityShards > 256 {
+			t.Errorf("size %d: %d+%d shards", tt.size, h.DataShards, h.ParityShards)
+		}
+		if h.Stripes*h.DataShards < n || (h.Stripes-1)*h.DataShards >= n {
+			t.Errorf("size %d: %d stripes of %d do not fit %d blocks", tt.size, h.Stripes, h.DataShards, n)
+		}
+
+		// Parity covers at least percent of the data, per stripe and in total, plus at most one
+		// rounding block per stripe.
+		parity := h.Stripes * h.ParityShards
+		if h.ParityShards*100 < h.DataShards*tt.percent {
+			t.Errorf("size %d: %d parity shards for %d data shards is below %d%%", tt.size, h.ParityShards, h.DataShards, tt.percent)
+		}
+		if limit := (n*tt.percent+99)/100 + h.Stripes; parity > limit {
+			t.Errorf("size %d: %d parity blocks for %d data blocks at %d%%, want at most %d", tt.size, parity, n, tt.percent, limit)
+		}
+	}
+}
+
+// writeRandom writes size random bytes to a new file and returns its path and content.
+func writeRandom(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	file := filepath.Join(t.TempDir(), "vault.tar.gz")
+	if err := os.WriteFile(file, data, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	return file, data
+}
+
+func TestCreateSidecarSize(t *testing.T) {
+	file, data := writeRandom(t, 295<<10)
+	if err := Create(file, 10); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file + Ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10% plus rounding and the hash tables, instead of the 20% a padded last stripe used to cost.
+	if ratio := float64(info.Size()) / float64(len(data)); ratio < 0.10 || ratio > 0.13 {
+		t.Errorf("sidecar is %.1f%% of the archive", ratio*100)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	file, data := writeRandom(t, 1<<20+123)
+	if err := Create(file, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := Check(file); err != nil || !res.OK() {
+		t.Fatalf("Check on intact archive = %+v, %v", res, err)
+	}
+
+	// A contiguous run of damage is spread over the stripes by the interleaving.
+	damaged := bytes.Clone(data)
+	for i := 200 << 10; i < 280<<10; i++ {
+		damaged[i] ^= 0x5a
+	}
+	if err := os.WriteFile(file, damaged, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Repair(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Damaged == 0 || res.Repaired != res.Damaged {
+		t.Errorf("result = %+v", res)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("repaired archive differs from the original")
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestRepairTruncated(t *testing.T) {
+	file, data := writeRandom(t, 300<<10)
+	if err := Create(file, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(file, int64(len(data)-1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Repair(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Resized {
+		t.Errorf("result = %+v, want Resized", res)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("repaired archive differs from the original")
+	}
+}
+
+func TestRepairUnrecoverable(t *testing.T) {
+	file, data := writeRandom(t, 300<<10)
+	if err := Create(file, 5); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(data)/2; i++ {
+		data[i] ^= 0xff
+	}
+	if err := os.WriteFile(file, data, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Repair(file); !errors.Is(err, ErrUnrecoverable) {
+		t.Fatalf("err = %v, want ErrUnrecoverable", err)
+	}
+}
@@ -0,0 +1,143 @@
+package pattern
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Matcher matches slash-separated relative paths against gitignore-style patterns.
+//
+// Supported syntax: "*", "?" and "[...]" within a path segment, "**" across
+// segments, a leading "/" or an inner "/" to anchor the pattern to the root,
+// a trailing "/" to match directories only and a leading "!" to negate.
+// When several patterns match, the last one wins.
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	negate   bool
+	dirOnly  bool
+	segments []string
+}
+
+// New compiles the given patterns. Empty lines and lines starting with "#" are ignored.
+func New(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, raw := range patterns {
+		p := strings.TrimSpace(raw)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		var r rule
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+
+		// Patterns without an inner slash match at any depth.
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			return nil, fmt.Errorf("invalid pattern: %q", raw)
+		}
+
+		r.segments = strings.Split(p, "/")
+		if !anchored {
+			r.segments = append([]string{"**"}, r.segments...)
+		}
+		for _, seg := range r.segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", raw, err)
+			}
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// Empty reports whether the matcher has no patterns.
+func (m *Matcher) Empty() bool {
+	return len(m.rules) == 0
+}
+
+// Match reports whether name, or any of its parent directories, matches.
+// As in gitignore, a path inside a matched directory cannot be negated back.
+func (m *Matcher) Match(name string, isDir bool) bool {
+	segments := strings.Split(strings.Trim(path.Clean(name), "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if m.matchSegments(segments[:i], true) {
+			return true
+		}
+	}
+	return m.matchSegments(segments, isDir)
+}
+
+// CouldMatchUnder reports whether some path below the directory dir might match.
+func (m *Matcher) CouldMatchUnder(dir string) bool {
+	segments := strings.Split(strings.Trim(path.Clean(dir), "/"), "/")
+	for _, r := range m.rules {
+		if !r.negate && matchPrefix(r.segments, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchSegments(segments []string, isDir bool) bool {
+	matched := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if match(r.segments, segments) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// match reports whether the pattern segments match all path segments.
+func match(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if match(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return match(pattern[1:], segments[1:])
+}
+
+// matchPrefix reports whether the path segments can be the leading part of a match.
+func matchPrefix(pattern, segments []string) bool {
+	if len(segments) == 0 {
+		return true
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return true
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchPrefix(pattern[1:], segments[1:])
+}
@@ -0,0 +1,201 @@
+package pattern
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	type check struct {
+		name  string
+		isDir bool
+		want  bool
+	}
+	tests := []struct {
+		patterns []string
+		checks   []check
+	}{
+		{
+			// Without a slash, a pattern matches at any depth.
+			patterns: []string{"*.log"},
+			checks: []check{
+				{"app.log", false, true},
+				{"logs/app.log", false, true},
+				{"a/b/c/app.log", false, true},
+				{"app.log.1", false, false},
+				{"applog", false, false},
+			},
+		},
+		{
+			// A leading slash anchors to the root.
+			patterns: []string{"/db.sqlite3-wal"},
+			checks: []check{
+				{"db.sqlite3-wal", false, true},
+				{"backup/db.sqlite3-wal", false, false},
+			},
+		},
+		{
+			// An inner slash anchors too.
+			patterns: []string{"icon_cache/*.png"},
+			checks: []check{
+				{"icon_cache/a.png", false, true},
+				{"data/icon_cache/a.png", false, false},
+				{"icon_cache/sub/a.png", false, false},
+			},
+		},
+		{
+			patterns: []string{"attachments/**/*.tmp"},
+			checks: []check{
+				{"attachments/x.tmp", false, true},
+				{"attachments/a/x.tmp", false, true},
+				{"attachments/a/b/c/x.tmp", false, true},
+				{"sends/a/x.tmp", false, false},
+			},
+		},
+		{
+			patterns: []string{"**/cache"},
+			checks: []check{
+				{"cache", true, true},
+				{"a/b/cache", true, true},
+				{"a/b/cache/file", false, true},
+				{"a/b/cached", true, false},
+			},
+		},
+		{
+			patterns: []string{"tmp/**"},
+			checks: []check{
+				{"tmp/a", false, true},
+				{"tmp/a/b", false, true},
+				{"other/tmp/a", false, false},
+			},
+		},
+		{
+			// A trailing slash matches directories only, and everything inside them.
+			patterns: []string{"icon_cache/"},
+			checks: []check{
+				{"icon_cache", true, true},
+				{"icon_cache", false, false},
+				{"icon_cache/a.png", false, true},
+				{"data/icon_cache/a.png", false, true},
+			},
+		},
+		{
+			// The last matching pattern wins.
+			patterns: []string{"*.log", "!keep.log"},
+			checks: []check{
+				{"app.log", false, true},
+				{"keep.log", false, false},
+				{"logs/keep.log", false, false},
+			},
+		},
+		{
+			patterns: []string{"!keep.log", "*.log"},
+			checks: []check{
+				{"keep.log", false, true},
+			},
+		},
+		{
+			// A file inside an excluded directory cannot be negated back.
+			patterns: []string{"logs/", "!logs/keep.log"},
+			checks: []check{
+				{"logs/app.log", false, true},
+				{"logs/keep.log", false, true},
+			},
+		},
+		{
+			patterns: []string{"logs/*", "!logs/keep.log"},
+			checks: []check{
+				{"logs/app.log", false, true},
+				{"logs/keep.log", false, false},
+			},
+		},
+		{
+			patterns: []string{"file?.[0-9]"},
+			checks: []check{
+				{"file1.5", false, true},
+				{"file12.5", false, false},
+				{"file1.x", false, false},
+			},
+		},
+		{
+			patterns: []string{"", "  ", "# comment", "  rsa_key*  "},
+			checks: []check{
+				{"rsa_key.pem", false, true},
+				{"# comment", false, false},
+			},
+		},
+		{
+			patterns: []string{"/config.json"},
+			checks: []check{
+				{"./config.json", false, true},
+				{"/config.json", false, true},
+				{"sub/../config.json", false, true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		m, err := New(tt.patterns)
+		if err != nil {
+			t.Fatalf("New(%q): %v", tt.patterns, err)
+		}
+		for _, c := range tt.checks {
+			if got := m.Match(c.name, c.isDir); got != c.want {
+				t.Errorf("%q: Match(%q, dir=%v) = %v, want %v", tt.patterns, c.name, c.isDir, got, c.want)
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, patterns := range [][]string{
+		{"/"},
+		{"!/"},
+		{"//"},
+		{"[a-"},
+		{"ok", "bad["},
+	} {
+		if _, err := New(patterns); err == nil {
+			t.Errorf("New(%q) succeeded", patterns)
+		}
+	}
+
+	m, err := New([]string{"", "# only comments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Empty() {
+		t.Error("matcher with only comments is not empty")
+	}
+	if m.Match("anything", false) {
+		t.Error("empty matcher matched")
+	}
+}
+
+func TestCouldMatchUnder(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		dir      string
+		want     bool
+	}{
+		{[]string{"attachments/a1/*.jpg"}, "attachments", true},
+		{[]string{"attachments/a1/*.jpg"}, "attachments/a1", true},
+		{[]string{"attachments/a1/*.jpg"}, "attachments/a2", false},
+		{[]string{"attachments/a1/*.jpg"}, "sends", false},
+		{[]string{"attachments/*/*.jpg"}, "attachments/a2", true},
+		// A pattern that ends above dir matches the directory itself, not only paths below it.
+		{[]string{"attachments/a1/*.jpg"}, "attachments/a1/x.jpg/deeper", false},
+		{[]string{"*.jpg"}, "anything/at/all", true},
+		{[]string{"/attachments/**/x"}, "attachments/a/b/c", true},
+		{[]string{"/attachments/**/x"}, "sends/a", false},
+		// Negations never add matches, so they do not keep a directory.
+		{[]string{"!sends/**"}, "sends", false},
+		{[]string{"sends/", "!sends/keep"}, "sends", true},
+		{nil, "attachments", false},
+	}
+	for _, tt := range tests {
+		m, err := New(tt.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.CouldMatchUnder(tt.dir); got != tt.want {
+			t.Errorf("%q: CouldMatchUnder(%q) = %v, want %v", tt.patterns, tt.dir, got, tt.want)
+		}
+	}
+}
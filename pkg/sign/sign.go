@@ -0,0 +1,242 @@
+// Package sign creates and verifies detached Ed25519 signatures for archives.
+//
+// The signature is stored next to the archive in a small JSON sidecar. It signs a
+// statement naming the archive and its size and SHA-256, so an archive cannot be
+// replaced, nor a genuine archive renamed to take the place of another one,
+// without the private key.
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Ext is appended to the archive file name to form the signature file name.
+const Ext = ".sig"
+
+// PublicExt is appended to the private key path to form the public key path.
+const PublicExt = ".pub"
+
+const (
+	format = 1
+	domain = "vaultwarden-backup archive signature\n"
+)
+
+var (
+	// ErrUnsigned is returned when the archive has no signature file.
+	ErrUnsigned = errors.New("archive is not signed")
+	// ErrBadSignature is returned when the signature does not match the archive or the key.
+	ErrBadSignature = errors.New("bad signature")
+)
+
+// statement is the signed content.
+type statement struct {
+	Format  int    `json:"format"`
+	Archive string `json:"archive"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Key     string `json:"key"`
+}
+
+// sidecar is the signature file.
+type sidecar struct {
+	statement
+	Signature []byte `json:"signature"`
+}
+
+// message returns the bytes covered by the signature.
+func (s statement) message() ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(domain), data...), nil
+}
+
+// KeyID returns a short identifier of a public key.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign hashes file and writes its signature to file+Ext.
+func Sign(file string, key ed25519.PrivateKey) error {
+	size, sum, err := hashFile(file)
+	if err != nil {
+		return err
+	}
+
+	st := statement{
+		Format:  format,
+		Archive: filepath.Base(file),
+		Size:    size,
+		SHA256:  sum,
+		Key:     KeyID(key.Public().(ed25519.PublicKey)),
+	}
+	msg, err := st.message()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sidecar{statement: st, Signature: ed25519.Sign(key, msg)}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := file + Ext + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file+Ext)
+}
+
+// Verify checks that file+Ext is a valid signature of file by pub.
+func Verify(file string, pub ed25519.PublicKey) error {
+	data, err := os.ReadFile(file + Ext)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrUnsigned
+	}
+	if err != nil {
+		return err
+	}
+
+	var sig sidecar
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return fmt.Errorf("%w: invalid signature file: %v", ErrBadSignature, err)
+	}
+	if sig.Format != format {
+		return fmt.Errorf("%w: unsupported signature format %d", ErrBadSignature, sig.Format)
+	}
+	if id := KeyID(pub); sig.Key != id {
+		return fmt.Errorf("%w: signed by key %s, expected %s", ErrBadSignature, sig.Key, id)
+	}
+	msg, err := sig.statement.message()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, msg, sig.Signature) {
+		return fmt.Errorf("%w: signature does not verify", ErrBadSignature)
+	}
+	if name := filepath.Base(file); sig.Archive != name {
+		return fmt.Errorf("%w: signature is for %s, not %s", ErrBadSignature, sig.Archive, name)
+	}
+
+	size, sum, err := hashFile(file)
+	if err != nil {
+		return err
+	}
+	if size != sig.Size || sum != sig.SHA256 {
+		return fmt.Errorf("%w: archive content does not match the signature", ErrBadSignature)
+	}
+	return nil
+}
+
+// GenerateKey creates a new key pair, writing the private key to path and the
+// public key to path+PublicExt. Existing files are not overwritten.
+func GenerateKey(path string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writePEM(path, "PRIVATE KEY", privDER, 0o600); err != nil {
+		return nil, err
+	}
+	if err := writePEM(path+PublicExt, "PUBLIC KEY", pubDER, 0o644); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return pub, nil
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #8 Ed25519 private key.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads a PEM encoded PKIX Ed25519 public key.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", path)
+	}
+	return pub, nil
+}
+
+func readPEM(path, blockType string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: no PEM %s block found", path, blockType)
+	}
+	return block, nil
+}
+
+func writePEM(path, blockType string, der []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
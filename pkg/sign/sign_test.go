@@ -0,0 +1,300 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newKey generates a key pair in dir and loads the private key back.
+func newKey(t *testing.T, dir, name string) (ed25519.PrivateKey, ed25519.PublicKey) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	pub, err := GenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := LoadPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPublicKey(path + PublicExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(loaded) || !pub.Equal(priv.Public()) {
+		t.Fatal("loaded keys do not match the generated key")
+	}
+	return priv, pub
+}
+
+// signedArchive writes an archive into dir and signs it.
+func signedArchive(t *testing.T, dir string, key ed25519.PrivateKey) string {
+	t.Helper()
+	file := filepath.Join(dir, "vault_20260101_120000.tar.gz")
+	if err := os.WriteFile(file, []byte("encrypted archive content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(file, key); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// editSidecar rewrites a field of the signature file, keeping the signature itself.
+func editSidecar(t *testing.T, file string, edit func(*sidecar)) {
+	t.Helper()
+	data, err := os.ReadFile(file + Ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig sidecar
+	if err := json.Unmarshal(data, &sig); err != nil {
+		t.Fatal(err)
+	}
+	edit(&sig)
+	if data, err = json.Marshal(sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file+Ext, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	keys := t.TempDir()
+	priv, pub := newKey(t, keys, "backup.key")
+	other, otherPub := newKey(t, keys, "other.key")
+
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, file string) string // returns the path to verify
+		pub     ed25519.PublicKey
+		wantErr error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "archive modified",
+			tamper: func(t *testing.T, file string) string {
+				if err := os.WriteFile(file, []byte("encrypted archive CONTENT"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "archive truncated",
+			tamper: func(t *testing.T, file string) string {
+				if err := os.Truncate(file, 5); err != nil {
+					t.Fatal(err)
+				}
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "wrong key",
+			pub:     otherPub,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "size edited",
+			tamper: func(t *testing.T, file string) string {
+				editSidecar(t, file, func(s *sidecar) { s.Size++ })
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "archive name edited",
+			tamper: func(t *testing.T, file string) string {
+				editSidecar(t, file, func(s *sidecar) { s.Archive = "vault_20260102_120000.tar.gz" })
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "key id edited",
+			tamper: func(t *testing.T, file string) string {
+				editSidecar(t, file, func(s *sidecar) { s.Key = KeyID(otherPub) })
+				return file
+			},
+			pub:     otherPub,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "signed by another key",
+			tamper: func(t *testing.T, file string) string {
+				if err := Sign(file, other); err != nil {
+					t.Fatal(err)
+				}
+				editSidecar(t, file, func(s *sidecar) { s.Key = KeyID(pub) })
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "renamed archive",
+			tamper: func(t *testing.T, file string) string {
+				renamed := filepath.Join(filepath.Dir(file), "vault_20260102_120000.tar.gz")
+				if err := os.Rename(file, renamed); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(file+Ext, renamed+Ext); err != nil {
+					t.Fatal(err)
+				}
+				return renamed
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "unsigned",
+			tamper: func(t *testing.T, file string) string {
+				if err := os.Remove(file + Ext); err != nil {
+					t.Fatal(err)
+				}
+				return file
+			},
+			wantErr: ErrUnsigned,
+		},
+		{
+			name: "garbage signature file",
+			tamper: func(t *testing.T, file string) string {
+				if err := os.WriteFile(file+Ext, []byte("not json"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "unknown format",
+			tamper: func(t *testing.T, file string) string {
+				editSidecar(t, file, func(s *sidecar) { s.Format = format + 1 })
+				return file
+			},
+			wantErr: ErrBadSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := signedArchive(t, t.TempDir(), priv)
+			if tt.tamper != nil {
+				file = tt.tamper(t, file)
+			}
+			key := tt.pub
+			if key == nil {
+				key = pub
+			}
+			err := Verify(file, key)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateKeyKeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.key")
+	if _, err := GenerateKey(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateKey(path); err == nil {
+		t.Fatal("GenerateKey overwrote an existing key")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("private key changed")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("private key mode = %v, %v", info.Mode().Perm(), err)
+	}
+}
+
+func TestLoadMalformedKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup.key")
+	if _, err := GenerateKey(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPub, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	block := func(typ string, der []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	}
+
+	tests := []struct {
+		name string
+		path string
+		load func(string) error
+	}{
+		{"missing file", filepath.Join(dir, "missing.pub"), loadPublic},
+		{"not PEM", write("text.pub", []byte("ssh-ed25519 AAAA")), loadPublic},
+		{"private key as public key", path, loadPublic},
+		{"public key as private key", path + PublicExt, loadPrivate},
+		{"corrupt public key", write("corrupt.pub", block("PUBLIC KEY", []byte("junk"))), loadPublic},
+		{"corrupt private key", write("corrupt.key", block("PRIVATE KEY", []byte("junk"))), loadPrivate},
+		{"ECDSA public key", write("ec.pub", block("PUBLIC KEY", ecPub)), loadPublic},
+		{"ECDSA private key", write("ec.key", block("PRIVATE KEY", ecPriv)), loadPrivate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.load(tt.path); err == nil {
+				t.Errorf("loading %s succeeded", filepath.Base(tt.path))
+			}
+		})
+	}
+}
+
+func loadPublic(path string) error {
+	_, err := LoadPublicKey(path)
+	return err
+}
+
+func loadPrivate(path string) error {
+	_, err := LoadPrivateKey(path)
+	return err
+}
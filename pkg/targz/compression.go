@@ -0,0 +1,267 @@
+package targz
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression applied to the tar stream.
+type Codec byte
+
+const (
+	None Codec = iota
+	Gzip
+	Zstd
+)
+
+func (c Codec) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("codec(%d)", byte(c))
+}
+
+// Ext returns the file extension of an archive written with the codec.
+func (c Codec) Ext() string {
+	switch c {
+	case Gzip:
+		return ".tar.gz"
+	case Zstd:
+		return ".tar.zst"
+	}
+	return ".tar"
+}
+
+// Exts lists the archive file extensions of all codecs.
+func Exts() []string {
+	return []string{Gzip.Ext(), Zstd.Ext(), None.Ext()}
+}
+
+// Compression selects the codec and level used by Create. Level 0 uses the codec's default.
+// For zstd the level is a zstd.EncoderLevel: the encoder only implements four distinct
+// levels, so they are named rather than numbered like the reference zstd levels 1-22.
+type Compression struct {
+	Codec Codec
+	Level int
+}
+
+// DefaultCompression is gzip at its default level, the format of archives written before
+// the compression became configurable.
+var DefaultCompression = Compression{Codec: Gzip}
+
+// ParseCompression parses "gzip", "zstd" or "none", optionally followed by ":level":
+// gzip takes 1-9, zstd takes fastest, default, better or best.
+func ParseCompression(s string) (Compression, error) {
+	name, levelStr, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	var c Compression
+	switch name {
+	case "gzip":
+		c.Codec = Gzip
+	case "zstd":
+		c.Codec = Zstd
+	case "none":
+		c.Codec = None
+	default:
+		return c, fmt.Errorf("unknown compression %q, expected gzip, zstd or none", s)
+	}
+
+	if !hasLevel {
+		return c, nil
+	}
+	switch c.Codec {
+	case Gzip:
+		level, err := strconv.Atoi(levelStr)
+		if err != nil || level < gzip.BestSpeed || level > gzip.BestCompression {
+			return c, fmt.Errorf("invalid gzip level %q, expected 1-9", levelStr)
+		}
+		c.Level = level
+	case Zstd:
+		ok, level := zstd.EncoderLevelFromString(levelStr)
+		if !ok {
+			return c, fmt.Errorf("invalid zstd level %q, expected fastest, default, better or best", levelStr)
+		}
+		c.Level = int(level)
+	default:
+		return c, fmt.Errorf("compression %s does not take a level", name)
+	}
+	return c, nil
+}
+
+func (c Compression) String() string {
+	switch {
+	case c.Level == 0:
+		return c.Codec.String()
+	case c.Codec == Zstd:
+		return c.Codec.String() + ":" + zstd.EncoderLevel(c.Level).String()
+	}
+	return c.Codec.String() + ":" + strconv.Itoa(c.Level)
+}
+
+// MarshalText formats c like String, so that it is logged and encoded as text.
+func (c Compression) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Ext returns the file extension of an archive written with c.
+func (c Compression) Ext() string {
+	return c.Codec.Ext()
+}
+
+// The tar stream is preceded by a header naming the codec, so that readers do not depend
+// on the file extension. Archives without the header are gzip.
+const (
+	magic         = "VWBTAR"
+	headerVersion = 1
+	headerSize    = len(magic) + 2
+)
+
+// writeHeader writes the stream header for codec.
+func writeHeader(w io.Writer, codec Codec) error {
+	_, err := w.Write(append([]byte(magic), headerVersion, byte(codec)))
+	return err
+}
+
+// newReader reads the stream header and returns a reader of the decompressed tar stream.
+func newReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	codec := Gzip
+	if head, err := br.Peek(headerSize); err == nil && string(head[:len(magic)]) == magic {
+		if head[len(magic)] != headerVersion {
+			return nil, fmt.Errorf("unsupported archive header version %d", head[len(magic)])
+		}
+		codec = Codec(head[len(magic)+1])
+		br.Discard(headerSize)
+	}
+
+	switch codec {
+	case None:
+		return io.NopCloser(br), nil
+	case Gzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gr, nil
+	case Zstd:
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", byte(codec))
+}
+
+// storeMinSize is the smallest already compressed file worth a separate stored member.
+const storeMinSize = 64 << 10
+
+// compressedExts are file types whose content is already compressed.
+var compressedExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	".mp3": true, ".m4a": true, ".ogg": true, ".opus": true, ".mp4": true, ".mov": true, ".webm": true, ".mkv": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".pdf": true, ".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true, ".epub": true,
+}
+
+// precompressed reports whether a file should be stored without recompression.
+func precompressed(name string, size int64) bool {
+	return size >= storeMinSize && compressedExts[strings.ToLower(path.Ext(name))]
+}
+
+// compressor writes the tar stream as a sequence of compressed members (gzip members or
+// zstd frames). Decompressors read consecutive members as one stream, which lets already
+// compressed files go into members that do not spend time recompressing them: gzip
+// stores them, zstd uses its fastest level and emits incompressible blocks raw.
+type compressor struct {
+	w      io.Writer
+	comp   Compression
+	stored bool
+	cur    io.WriteCloser
+}
+
+func (c *compressor) Write(p []byte) (int, error) {
+	if c.cur == nil {
+		if err := c.open(); err != nil {
+			return 0, err
+		}
+	}
+	return c.cur.Write(p)
+}
+
+// setStored switches between normal and stored members, ending the current member if the mode changes.
+func (c *compressor) setStored(stored bool) error {
+	if stored == c.stored || c.comp.Codec == None {
+		return nil
+	}
+	c.stored = stored
+	if c.cur == nil {
+		return nil
+	}
+	err := c.cur.Close()
+	c.cur = nil
+	return err
+}
+
+func (c *compressor) open() error {
+	switch c.comp.Codec {
+	case None:
+		c.cur = nopWriteCloser{c.w}
+	case Gzip:
+		level := gzip.DefaultCompression
+		if c.comp.Level != 0 {
+			level = c.comp.Level
+		}
+		if c.stored {
+			level = gzip.NoCompression
+		}
+		gw, err := gzip.NewWriterLevel(c.w, level)
+		if err != nil {
+			return err
+		}
+		c.cur = gw
+	case Zstd:
+		level := zstd.SpeedDefault
+		if c.comp.Level != 0 {
+			level = zstd.EncoderLevel(c.comp.Level)
+		}
+		if c.stored {
+			level = zstd.SpeedFastest
+		}
+		zw, err := zstd.NewWriter(c.w, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return err
+		}
+		c.cur = zw
+	default:
+		return fmt.Errorf("unknown compression codec %d", byte(c.comp.Codec))
+	}
+	return nil
+}
+
+// Close ends the last member.
+func (c *compressor) Close() error {
+	if c.cur == nil {
+		if err := c.open(); err != nil {
+			return err
+		}
+	}
+	return c.cur.Close()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -2,21 +2,55 @@ package targz
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-// Create creates a tar.gz archive from the source directory and writes it to the writer.
-func Create(src string, writer io.Writer) error {
-	gw := gzip.NewWriter(writer)
-	defer gw.Close()
+// Entry is an in-memory file written to the archive before the directory contents.
+type Entry struct {
+	Name string
+	Data []byte
+}
+
+// Create creates a compressed tar archive from the source directory and writes it to the writer,
+// preceded by a header naming the codec. Any leading entries are written first, in order.
+// Already compressed files are not compressed again.
+func Create(src string, writer io.Writer, comp Compression, leading ...Entry) error {
+	if err := writeHeader(writer, comp.Codec); err != nil {
+		return err
+	}
+	cw := &compressor{w: writer, comp: comp}
+	tw := tar.NewWriter(cw)
+
+	if err := writeEntries(src, tw, cw, leading); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
 
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+func writeEntries(src string, tw *tar.Writer, cw *compressor, leading []Entry) error {
+	for _, e := range leading {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.Name,
+			Size:     int64(len(e.Data)),
+			Mode:     0644,
+			ModTime:  time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.Data); err != nil {
+			return err
+		}
+	}
 
 	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -42,6 +76,16 @@ func Create(src string, writer io.Writer) error {
 			return nil
 		}
 
+		// Finish the previous entry before a file may start a new member
+		if info.Mode().IsRegular() {
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if err := cw.setStored(precompressed(header.Name, info.Size())); err != nil {
+				return err
+			}
+		}
+
 		if err := tw.WriteHeader(header); err != nil {
 			return err
 		}
@@ -62,15 +106,48 @@ func Create(src string, writer io.Writer) error {
 	})
 }
 
-// Extract extracts a tar.gz archive from the reader to the specified directory.
+// Walk reads an archive written by Create from the reader and calls fn for every entry, in
+// archive order. fn may read the entry content from r; unread content is skipped. The
+// compressed stream is read to the end so that a truncated or corrupted archive is reported
+// even after the last entry.
+func Walk(reader io.Reader, fn func(header *tar.Header, r io.Reader) error) error {
+	dec, err := newReader(reader)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	tarReader := tar.NewReader(dec)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if err := fn(header, tarReader); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.Copy(io.Discard, dec); err != nil {
+		return fmt.Errorf("failed to read compressed stream: %w", err)
+	}
+	return nil
+}
+
+// Extract extracts an archive written by Create, or a plain tar.gz archive, from the reader
+// to the specified directory.
 func Extract(reader io.Reader, extractDir string) error {
-	gzReader, err := gzip.NewReader(reader)
+	dec, err := newReader(reader)
 	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+		return err
 	}
-	defer gzReader.Close()
+	defer dec.Close()
 
-	tarReader := tar.NewReader(gzReader)
+	tarReader := tar.NewReader(dec)
 
 	for {
 		header, err := tarReader.Next()